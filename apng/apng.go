@@ -0,0 +1,148 @@
+package apng
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"time"
+)
+
+// writes animated PNGs a frame at a time, so an animation never has to be held
+// in memory.  Each frame is encoded by image/png and its image data moved into
+// the animation chunks.
+
+// pngSignature starts every PNG file
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// Encoder writes an animated PNG
+type Encoder struct {
+	w      io.Writer
+	frames int
+	added  int
+	seq    uint32
+	ihdr   []byte
+}
+
+// NewEncoder starts an animation of frames frames, which loops forever
+func NewEncoder(w io.Writer, frames int) *Encoder {
+	return &Encoder{w: w, frames: frames}
+}
+
+// Add writes the next frame, shown for delay.  Every frame must be the size and
+// have the same transparency as the first.
+func (e *Encoder) Add(img image.Image, delay time.Duration) error {
+	if e.added == e.frames {
+		return errors.New("apng: more frames than the animation was started with")
+	}
+	buf := bytes.Buffer{}
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	chunks, err := readChunks(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	if e.added == 0 {
+		e.ihdr = chunks[0].data
+		if _, err := e.w.Write(pngSignature); err != nil {
+			return err
+		}
+		if err := e.chunk("IHDR", e.ihdr); err != nil {
+			return err
+		}
+		actl := make([]byte, 8)
+		binary.BigEndian.PutUint32(actl[0:], uint32(e.frames))
+		if err := e.chunk("acTL", actl); err != nil {
+			return err
+		}
+	} else if !bytes.Equal(chunks[0].data, e.ihdr) {
+		return errors.New("apng: every frame must be the size and kind of the first")
+	}
+
+	b := img.Bounds()
+	fctl := make([]byte, 26)
+	binary.BigEndian.PutUint32(fctl[0:], e.seq)
+	binary.BigEndian.PutUint32(fctl[4:], uint32(b.Dx()))
+	binary.BigEndian.PutUint32(fctl[8:], uint32(b.Dy()))
+	binary.BigEndian.PutUint16(fctl[20:], uint16(delay/time.Millisecond))
+	binary.BigEndian.PutUint16(fctl[22:], 1000)
+	e.seq++
+	if err := e.chunk("fcTL", fctl); err != nil {
+		return err
+	}
+	for _, c := range chunks {
+		if c.kind != "IDAT" {
+			continue
+		}
+		if e.added == 0 {
+			err = e.chunk("IDAT", c.data)
+		} else {
+			// later frames number their data chunks
+			fdat := make([]byte, 4, 4+len(c.data))
+			binary.BigEndian.PutUint32(fdat, e.seq)
+			e.seq++
+			err = e.chunk("fdAT", append(fdat, c.data...))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	e.added++
+	return nil
+}
+
+// Close finishes the animation, after all its frames are added
+func (e *Encoder) Close() error {
+	if e.added != e.frames {
+		return errors.New("apng: fewer frames than the animation was started with")
+	}
+	return e.chunk("IEND", nil)
+}
+
+type chunk struct {
+	kind string
+	data []byte
+}
+
+// readChunks splits a PNG file into its chunks, IHDR first
+func readChunks(data []byte) ([]chunk, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errors.New("apng: not a PNG")
+	}
+	data = data[len(pngSignature):]
+	chunks := []chunk{}
+	for len(data) >= 12 {
+		n := int(binary.BigEndian.Uint32(data))
+		if n > len(data)-12 {
+			return nil, errors.New("apng: truncated PNG chunk")
+		}
+		chunks = append(chunks, chunk{kind: string(data[4:8]), data: data[8 : 8+n]})
+		data = data[12+n:]
+	}
+	if len(chunks) == 0 || chunks[0].kind != "IHDR" {
+		return nil, errors.New("apng: PNG doesn't start with IHDR")
+	}
+	return chunks, nil
+}
+
+// chunk writes a chunk with its length and CRC
+func (e *Encoder) chunk(kind string, data []byte) error {
+	head := make([]byte, 8)
+	binary.BigEndian.PutUint32(head, uint32(len(data)))
+	copy(head[4:], kind)
+	crc := crc32.NewIEEE()
+	crc.Write(head[4:])
+	crc.Write(data)
+	tail := make([]byte, 4)
+	binary.BigEndian.PutUint32(tail, crc.Sum32())
+	for _, b := range [][]byte{head, data, tail} {
+		if _, err := e.w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
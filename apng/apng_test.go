@@ -0,0 +1,52 @@
+package apng
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncoder(t *testing.T) {
+	buf := bytes.Buffer{}
+	enc := NewEncoder(&buf, 3)
+	for i := 0; i < 3; i++ {
+		img := image.NewRGBA(image.Rect(0, 0, 8, 4))
+		img.Set(i, 0, color.RGBA{0xff, 0, 0, 0xff})
+		assert.NoError(t, enc.Add(img, 100*time.Millisecond))
+	}
+	assert.Error(t, enc.Add(image.NewRGBA(image.Rect(0, 0, 8, 4)), time.Second))
+	assert.NoError(t, enc.Close())
+
+	// viewers without APNG support show the first frame
+	first, err := png.Decode(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 8, 4), first.Bounds())
+	r, _, _, _ := first.At(0, 0).RGBA()
+	assert.Equal(t, uint32(0xffff), r)
+
+	chunks, err := readChunks(buf.Bytes())
+	assert.NoError(t, err)
+	kinds := []string{}
+	seq := []uint32{}
+	for _, c := range chunks {
+		kinds = append(kinds, c.kind)
+		if c.kind == "fcTL" || c.kind == "fdAT" {
+			seq = append(seq, binary.BigEndian.Uint32(c.data))
+		}
+	}
+	assert.Equal(t, []string{"IHDR", "acTL", "fcTL", "IDAT", "fcTL", "fdAT", "fcTL", "fdAT", "IEND"}, kinds)
+	assert.Equal(t, []uint32{0, 1, 2, 3, 4}, seq)
+	assert.Equal(t, uint32(3), binary.BigEndian.Uint32(chunks[1].data))
+}
+
+func TestEncoderSizeMismatch(t *testing.T) {
+	enc := NewEncoder(&bytes.Buffer{}, 2)
+	assert.NoError(t, enc.Add(image.NewRGBA(image.Rect(0, 0, 8, 4)), time.Second))
+	assert.Error(t, enc.Add(image.NewRGBA(image.Rect(0, 0, 4, 4)), time.Second))
+}
@@ -0,0 +1,101 @@
+package canvas
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/geo/s2"
+)
+
+// Canvas is a drawing backend, so the legend and map objects can be drawn on a
+// raster image through gg or written out as vector graphics.  Coordinates are
+// in pixels from the top left, like gg.
+type Canvas interface {
+	Width() int
+	Height() int
+	// Image draws a raster image with its top left corner at x, y
+	Image(img image.Image, x, y float64)
+	// Rect fills a rectangle
+	Rect(x, y, w, h float64, fill color.Color)
+	// Polyline strokes a line through xy, a flat list of x, y pairs.  Dash is
+	// the on/off lengths of a dashed line, nil for a solid one.
+	Polyline(xy []float64, stroke color.Color, width float64, dash []float64)
+	// Polygon fills the shape with corners xy, a flat list of x, y pairs, and
+	// outlines it if width > 0
+	Polygon(xy []float64, fill, stroke color.Color, width float64)
+	// Text draws s anchored at x, y the same way as gg.DrawStringAnchored
+	Text(s string, x, y, ax, ay float64, col color.Color)
+	// MeasureString is the width and height of s in pixels
+	MeasureString(s string) (float64, float64)
+}
+
+// Projection turns a coordinate into pixels on a canvas
+type Projection func(ll s2.LatLng) (float64, float64)
+
+// Drawer is a map object that can draw itself on any Canvas, not just a gg
+// context
+type Drawer interface {
+	DrawCanvas(c Canvas, project Projection)
+}
+
+// GG draws on a gg context
+type GG struct {
+	*gg.Context
+}
+
+// NewGG wraps a gg context as a Canvas
+func NewGG(gc *gg.Context) *GG {
+	return &GG{Context: gc}
+}
+
+// Image draws a raster image with its top left corner at x, y
+func (c *GG) Image(img image.Image, x, y float64) {
+	c.DrawImage(img, int(x), int(y))
+}
+
+// Rect fills a rectangle
+func (c *GG) Rect(x, y, w, h float64, fill color.Color) {
+	c.DrawRectangle(x, y, w, h)
+	c.SetColor(fill)
+	c.Fill()
+}
+
+// Polyline strokes a line through xy
+func (c *GG) Polyline(xy []float64, stroke color.Color, width float64, dash []float64) {
+	c.ClearPath()
+	for i := 0; i+1 < len(xy); i += 2 {
+		c.LineTo(xy[i], xy[i+1])
+	}
+	c.SetColor(stroke)
+	c.SetLineWidth(width)
+	c.SetLineCap(gg.LineCapRound)
+	c.SetLineJoin(gg.LineJoinRound)
+	c.SetDash(dash...)
+	c.Stroke()
+	c.SetDash()
+}
+
+// Polygon fills and outlines a shape
+func (c *GG) Polygon(xy []float64, fill, stroke color.Color, width float64) {
+	c.ClearPath()
+	for i := 0; i+1 < len(xy); i += 2 {
+		c.LineTo(xy[i], xy[i+1])
+	}
+	c.ClosePath()
+	c.SetColor(fill)
+	if width <= 0 {
+		c.Fill()
+		return
+	}
+	c.FillPreserve()
+	c.SetColor(stroke)
+	c.SetLineWidth(width)
+	c.Stroke()
+}
+
+// Text draws s anchored at x, y
+func (c *GG) Text(s string, x, y, ax, ay float64, col color.Color) {
+	c.SetColor(col)
+	c.DrawStringAnchored(s, x, y, ax, ay)
+}
@@ -0,0 +1,252 @@
+package canvas
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/fogleman/gg"
+)
+
+// pdfFontSize makes Courier, whose glyphs are all 0.6 of the font size wide, as
+// wide as gg's built in 7x13 font, which is what labels are measured and placed
+// with
+const pdfFontSize = 7 / 0.6
+
+// PDF builds a single page PDF document.  Drawing is in pixels like every
+// canvas, the page scales them to its DPI and centers them on the paper.
+type PDF struct {
+	width, height int
+	pageWidth     float64 // points
+	pageHeight    float64 // points
+	scale         float64 // points per pixel
+	content       bytes.Buffer
+	images        []pdfImage
+	alphas        map[uint8]bool
+	measure       *gg.Context
+}
+
+type pdfImage struct {
+	width, height int
+	rgb           []byte
+	alpha         []byte // nil for an opaque image
+}
+
+// NewPDF starts an empty page of pageWidth x pageHeight points for a drawing of
+// width x height pixels at dpi
+func NewPDF(width, height int, dpi, pageWidth, pageHeight float64) *PDF {
+	p := &PDF{
+		width:      width,
+		height:     height,
+		pageWidth:  pageWidth,
+		pageHeight: pageHeight,
+		scale:      72 / dpi,
+		alphas:     map[uint8]bool{},
+		measure:    gg.NewContext(1, 1),
+	}
+	// flip to pixels from the top left, centered on the page
+	fmt.Fprintf(&p.content, "q %s 0 0 %s %s %s cm\n", num(p.scale), num(-p.scale),
+		num(round((pageWidth-float64(width)*p.scale)/2)), num(round((pageHeight+float64(height)*p.scale)/2)))
+	return p
+}
+
+// Width of the drawing in pixels
+func (p *PDF) Width() int {
+	return p.width
+}
+
+// Height of the drawing in pixels
+func (p *PDF) Height() int {
+	return p.height
+}
+
+// Image embeds a raster image, compressed losslessly
+func (p *PDF) Image(img image.Image, x, y float64) {
+	b := img.Bounds()
+	nrgba := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(nrgba, nrgba.Bounds(), img, b.Min, draw.Src)
+	pi := pdfImage{width: b.Dx(), height: b.Dy(), rgb: make([]byte, 0, 3*b.Dx()*b.Dy())}
+	alpha := make([]byte, 0, b.Dx()*b.Dy())
+	opaque := true
+	for i := 0; i < len(nrgba.Pix); i += 4 {
+		pi.rgb = append(pi.rgb, nrgba.Pix[i:i+3]...)
+		alpha = append(alpha, nrgba.Pix[i+3])
+		opaque = opaque && nrgba.Pix[i+3] == 0xff
+	}
+	if !opaque {
+		pi.alpha = alpha
+	}
+	p.images = append(p.images, pi)
+	// images fill the unit square bottom up
+	fmt.Fprintf(&p.content, "q %d 0 0 %d %s %s cm /Im%d Do Q\n", pi.width, -pi.height, num(x), num(y+float64(pi.height)), len(p.images))
+}
+
+// Rect fills a rectangle
+func (p *PDF) Rect(x, y, w, h float64, fill color.Color) {
+	fmt.Fprintf(&p.content, "q %s %s %s %s %s re f Q\n", p.paint(fill, false), num(round(x)), num(round(y)), num(round(w)), num(round(h)))
+}
+
+// Polyline strokes a line through xy
+func (p *PDF) Polyline(xy []float64, stroke color.Color, width float64, dash []float64) {
+	fmt.Fprintf(&p.content, "q %s %s w 1 J 1 j [%s] 0 d %s S Q\n", p.paint(stroke, true), num(width), strings.Replace(points(dash), ",", " ", -1), path(xy))
+}
+
+// Polygon fills and outlines a shape
+func (p *PDF) Polygon(xy []float64, fill, stroke color.Color, width float64) {
+	if width <= 0 {
+		fmt.Fprintf(&p.content, "q %s %s h f Q\n", p.paint(fill, false), path(xy))
+		return
+	}
+	fmt.Fprintf(&p.content, "q %s %s %s w 1 j %s h B Q\n", p.paint(fill, false), p.paint(stroke, true), num(width), path(xy))
+}
+
+// Text draws s anchored at x, y in Courier, sized to match gg's default font
+func (p *PDF) Text(s string, x, y, ax, ay float64, col color.Color) {
+	w, h := p.MeasureString(s)
+	x -= ax * w
+	y += ay * h
+	// the text matrix flips the glyphs back upright
+	fmt.Fprintf(&p.content, "q %s BT /F1 %s Tf 1 0 0 -1 %s %s Tm (%s) Tj ET Q\n", p.paint(col, false), num(round(pdfFontSize)), num(round(x)), num(round(y)), pdfString(s))
+}
+
+// MeasureString is the size of s in gg's default font
+func (p *PDF) MeasureString(s string) (float64, float64) {
+	return p.measure.MeasureString(s)
+}
+
+// paint sets the fill or stroke color, and its opacity through a graphics state
+func (p *PDF) paint(c color.Color, stroke bool) string {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	op := "rg"
+	if stroke {
+		op = "RG"
+	}
+	s := fmt.Sprintf("%s %s %s %s", num(round(float64(n.R)/0xff)), num(round(float64(n.G)/0xff)), num(round(float64(n.B)/0xff)), op)
+	if n.A < 0xff {
+		p.alphas[n.A] = true
+		s = fmt.Sprintf("/A%d gs %s", n.A, s)
+	}
+	return s
+}
+
+// WriteTo writes out the finished document
+func (p *PDF) WriteTo(w io.Writer) (int64, error) {
+	doc := bytes.Buffer{}
+	offsets := []int{}
+	obj := func(body string, stream []byte) {
+		offsets = append(offsets, doc.Len())
+		fmt.Fprintf(&doc, "%d 0 obj\n%s", len(offsets), body)
+		if stream != nil {
+			doc.WriteString("\nstream\n")
+			doc.Write(stream)
+			doc.WriteString("\nendstream")
+		}
+		doc.WriteString("\nendobj\n")
+	}
+	doc.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// 1 catalog, 2 pages, 3 page, 4 contents, 5 font, then the images
+	resources := strings.Builder{}
+	resources.WriteString("/Font << /F1 5 0 R >>")
+	if len(p.images) > 0 {
+		resources.WriteString(" /XObject <<")
+		next := 6
+		for i, img := range p.images {
+			fmt.Fprintf(&resources, " /Im%d %d 0 R", i+1, next)
+			next++
+			if img.alpha != nil {
+				next++
+			}
+		}
+		resources.WriteString(" >>")
+	}
+	if len(p.alphas) > 0 {
+		alphas := []int{}
+		for a := range p.alphas {
+			alphas = append(alphas, int(a))
+		}
+		sort.Ints(alphas)
+		resources.WriteString(" /ExtGState <<")
+		for _, a := range alphas {
+			fmt.Fprintf(&resources, " /A%d << /ca %s /CA %s >>", a, num(round(float64(a)/0xff)), num(round(float64(a)/0xff)))
+		}
+		resources.WriteString(" >>")
+	}
+
+	obj("<< /Type /Catalog /Pages 2 0 R >>", nil)
+	obj("<< /Type /Pages /Kids [3 0 R] /Count 1 >>", nil)
+	obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << %s >> /Contents 4 0 R >>",
+		num(round(p.pageWidth)), num(round(p.pageHeight)), resources.String()), nil)
+	content := deflate(append(p.content.Bytes(), "Q\n"...))
+	obj(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>", len(content)), content)
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>", nil)
+	for _, img := range p.images {
+		smask := ""
+		if img.alpha != nil {
+			smask = fmt.Sprintf(" /SMask %d 0 R", len(offsets)+2)
+		}
+		rgb := deflate(img.rgb)
+		obj(fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode%s /Length %d >>",
+			img.width, img.height, smask, len(rgb)), rgb)
+		if img.alpha != nil {
+			alpha := deflate(img.alpha)
+			obj(fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /FlateDecode /Length %d >>",
+				img.width, img.height, len(alpha)), alpha)
+		}
+	}
+
+	xref := doc.Len()
+	fmt.Fprintf(&doc, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&doc, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&doc, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return doc.WriteTo(w)
+}
+
+// path is the moveto and lineto operators through xy
+func path(xy []float64) string {
+	ops := make([]string, 0, len(xy)/2)
+	for i := 0; i+1 < len(xy); i += 2 {
+		op := "l"
+		if i == 0 {
+			op = "m"
+		}
+		ops = append(ops, num(round(xy[i]))+" "+num(round(xy[i+1]))+" "+op)
+	}
+	return strings.Join(ops, " ")
+}
+
+// pdfString escapes s for a literal string in the font's WinAnsi encoding,
+// characters it doesn't have become ?
+func pdfString(s string) string {
+	out := strings.Builder{}
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			out.WriteByte('\\')
+			out.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			out.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&out, "\\%03o", r)
+		default:
+			out.WriteByte('?')
+		}
+	}
+	return out.String()
+}
+
+func deflate(data []byte) []byte {
+	buf := bytes.Buffer{}
+	zw := zlib.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
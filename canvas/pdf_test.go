@@ -0,0 +1,57 @@
+package canvas
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPDF(t *testing.T) {
+	p := NewPDF(200, 100, 144, 300, 200)
+	opaque := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := 3; i < len(opaque.Pix); i += 4 {
+		opaque.Pix[i] = 0xff
+	}
+	p.Image(opaque, 0, 0)
+	p.Image(image.NewRGBA(image.Rect(0, 0, 4, 4)), 10, 10)
+	p.Polyline([]float64{0, 0, 10, 20}, color.Black, 3, []float64{6, 4})
+	p.Text("(a) \\ 5°", 10, 10, 0, 0, color.NRGBA{0xff, 0xff, 0xff, 0xcc})
+	buf := bytes.Buffer{}
+	_, err := p.WriteTo(&buf)
+	assert.NoError(t, err)
+	doc := buf.Bytes()
+
+	// every xref entry points at its object, and startxref at the table
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(doc, -1)
+	assert.Len(t, entries, 8)
+	for i, e := range entries {
+		off, _ := strconv.Atoi(string(e[1]))
+		assert.True(t, bytes.HasPrefix(doc[off:], []byte(fmt.Sprintf("%d 0 obj\n", i+1))), "object %d", i+1)
+	}
+	xref, _ := strconv.Atoi(string(regexp.MustCompile(`startxref\n(\d+)`).FindSubmatch(doc)[1]))
+	assert.True(t, bytes.HasPrefix(doc[xref:], []byte("xref\n")))
+
+	// the page is the drawing at 144 dpi, centered
+	assert.Contains(t, string(doc), "/MediaBox [0 0 300 200]")
+	assert.Contains(t, string(doc), "/Im1 6 0 R /Im2 7 0 R")
+	assert.Contains(t, string(doc), "/SMask 8 0 R")
+	assert.Contains(t, string(doc), "/A204 << /ca 0.8 /CA 0.8 >>")
+	m := regexp.MustCompile(`4 0 obj\n<< /Length (\d+) /Filter /FlateDecode >>\nstream\n`).FindSubmatchIndex(doc)
+	n, _ := strconv.Atoi(string(doc[m[2]:m[3]]))
+	zr, err := zlib.NewReader(bytes.NewReader(doc[m[1] : m[1]+n]))
+	assert.NoError(t, err)
+	content, err := ioutil.ReadAll(zr)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "q 0.5 0 0 -0.5 100 125 cm\n")
+	assert.Contains(t, string(content), "[6 4] 0 d 0 0 m 10 20 l S")
+	assert.Contains(t, string(content), "/A204 gs 1 1 1 rg BT")
+	assert.Contains(t, string(content), `(\(a\) \\ 5\260) Tj`)
+}
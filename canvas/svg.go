@@ -0,0 +1,161 @@
+package canvas
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/fogleman/gg"
+)
+
+// svgFontSize is picked so the default monospace font is about as wide as gg's
+// built in 7x13 font, which is what labels are measured and placed with
+const svgFontSize = 12
+
+// SVG builds an SVG document
+type SVG struct {
+	width, height int
+	body          bytes.Buffer
+	measure       *gg.Context
+}
+
+// NewSVG starts an empty SVG document of the given size in pixels
+func NewSVG(width, height int) *SVG {
+	return &SVG{width: width, height: height, measure: gg.NewContext(1, 1)}
+}
+
+// Width of the document in pixels
+func (s *SVG) Width() int {
+	return s.width
+}
+
+// Height of the document in pixels
+func (s *SVG) Height() int {
+	return s.height
+}
+
+// Image embeds a raster image as a PNG
+func (s *SVG) Image(img image.Image, x, y float64) {
+	buf := bytes.Buffer{}
+	if err := png.Encode(&buf, img); err != nil {
+		return
+	}
+	b := img.Bounds()
+	fmt.Fprintf(&s.body, `<image x="%s" y="%s" width="%d" height="%d" xlink:href="data:image/png;base64,%s"/>`+"\n",
+		num(x), num(y), b.Dx(), b.Dy(), base64.StdEncoding.EncodeToString(buf.Bytes()))
+}
+
+// Rect fills a rectangle
+func (s *SVG) Rect(x, y, w, h float64, fill color.Color) {
+	fmt.Fprintf(&s.body, `<rect x="%s" y="%s" width="%s" height="%s" %s/>`+"\n",
+		num(x), num(y), num(w), num(h), paint("fill", fill))
+}
+
+// Polyline strokes a line through xy
+func (s *SVG) Polyline(xy []float64, stroke color.Color, width float64, dash []float64) {
+	fmt.Fprintf(&s.body, `<polyline points="%s" fill="none" %s stroke-width="%s" stroke-linecap="round" stroke-linejoin="round"`,
+		points(xy), paint("stroke", stroke), num(width))
+	if len(dash) > 0 {
+		fmt.Fprintf(&s.body, ` stroke-dasharray="%s"`, points(dash))
+	}
+	s.body.WriteString("/>\n")
+}
+
+// Hover puts an invisible line through xy, width wide, that shows title as a
+// tooltip when the pointer is over it
+func (s *SVG) Hover(xy []float64, width float64, title string) {
+	text := strings.Builder{}
+	xml.EscapeText(&text, []byte(title))
+	fmt.Fprintf(&s.body, `<polyline points="%s" fill="none" stroke="#000" stroke-opacity="0" stroke-width="%s" stroke-linecap="round" stroke-linejoin="round" pointer-events="stroke"><title>%s</title></polyline>`+"\n",
+		points(xy), num(width), text.String())
+}
+
+// Polygon fills and outlines a shape
+func (s *SVG) Polygon(xy []float64, fill, stroke color.Color, width float64) {
+	fmt.Fprintf(&s.body, `<polygon points="%s" %s`, points(xy), paint("fill", fill))
+	if width > 0 {
+		fmt.Fprintf(&s.body, ` %s stroke-width="%s" stroke-linejoin="round"`, paint("stroke", stroke), num(width))
+	}
+	s.body.WriteString("/>\n")
+}
+
+// Text draws s anchored at x, y
+func (s *SVG) Text(str string, x, y, ax, ay float64, col color.Color) {
+	anchor := "start"
+	if ax >= 0.75 {
+		anchor = "end"
+	} else if ax >= 0.25 {
+		anchor = "middle"
+	}
+	baseline := "alphabetic"
+	if ay >= 0.75 {
+		baseline = "hanging"
+	} else if ay >= 0.25 {
+		baseline = "central"
+	}
+	text := strings.Builder{}
+	xml.EscapeText(&text, []byte(str))
+	fmt.Fprintf(&s.body, `<text x="%s" y="%s" font-family="monospace" font-size="%d" text-anchor="%s" dominant-baseline="%s" %s>%s</text>`+"\n",
+		num(x), num(y), svgFontSize, anchor, baseline, paint("fill", col), text.String())
+}
+
+// MeasureString is the size of s in gg's default font
+func (s *SVG) MeasureString(str string) (float64, float64) {
+	return s.measure.MeasureString(str)
+}
+
+// WriteTo writes out the finished document
+func (s *SVG) WriteTo(w io.Writer) (int64, error) {
+	header := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="%d" height="%d" viewBox="0 0 %d %d">
+`, s.width, s.height, s.width, s.height)
+	n, err := io.WriteString(w, header)
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := w.Write(s.body.Bytes())
+	if err != nil {
+		return int64(n + m), err
+	}
+	k, err := io.WriteString(w, "</svg>\n")
+	return int64(n + m + k), err
+}
+
+// num formats a number without trailing zeros
+func num(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func points(xy []float64) string {
+	parts := make([]string, 0, len(xy))
+	for i := 0; i+1 < len(xy); i += 2 {
+		parts = append(parts, num(round(xy[i]))+","+num(round(xy[i+1])))
+	}
+	if len(xy)%2 == 1 {
+		parts = append(parts, num(round(xy[len(xy)-1])))
+	}
+	return strings.Join(parts, " ")
+}
+
+// round to hundredths of a pixel, which keeps documents with long tracks small
+func round(f float64) float64 {
+	return math.Round(f*100) / 100
+}
+
+// paint is the fill or stroke attributes for a color, with its opacity
+func paint(attr string, c color.Color) string {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	s := fmt.Sprintf(`%s="#%02x%02x%02x"`, attr, n.R, n.G, n.B)
+	if n.A < 0xff {
+		s += fmt.Sprintf(` %s-opacity="%s"`, attr, num(round(float64(n.A)/0xff)))
+	}
+	return s
+}
@@ -1,19 +1,27 @@
 package colorpath
 
 import (
+	"image/color"
+	"math"
+	"time"
+
 	sm "github.com/flopp/go-staticmaps"
 	"github.com/fogleman/gg"
 	"github.com/golang/geo/s2"
 	"github.com/lucasb-eyer/go-colorful"
+	"github.com/meekmichael/gpxrainbow/canvas"
 )
 
 // implements the map object interface for go-staticmaps for a path object that can
 // vary the color of the path along the way
 
-// Point is a coordinate and a color
+// Point is a coordinate and a color, and when it was recorded if known
 type Point struct {
 	s2.LatLng
 	Color colorful.Color
+	Time  time.Time
+	// Value is what the color stands for, in the legend's units, NaN if unknown
+	Value float64
 }
 
 // ColorPath satisfies the map object interface for go-staticmap
@@ -21,6 +29,18 @@ type ColorPath struct {
 	sm.MapObject
 	Positions []Point
 	Weight    float64
+	// Dash is the on/off lengths of a dashed line, in pixels.  A dashed path is
+	// drawn entirely in the color of its first point.
+	Dash []float64
+	// Fade makes the path see through, from 0 for opaque to 1 for invisible
+	Fade float64
+	// Start is when the path's track started, zero if unknown
+	Start time.Time
+	// Name is the file the path came from
+	Name string
+	// Track numbers the track the path is a segment of, across every file, in
+	// overlap mode, where the segments of one track don't count as overlapping
+	Track int
 }
 
 // NewColorPath builds a new path with colors
@@ -57,8 +77,20 @@ func (cp *ColorPath) Draw(gc *gg.Context, trans *sm.Transformer) {
 	gc.SetLineCap(gg.LineCapRound)
 	gc.SetLineJoin(gg.LineJoinRound)
 
+	if len(cp.Dash) > 0 {
+		// stroking a piece at a time would restart the dash pattern every piece
+		gc.SetColor(cp.color(0))
+		gc.SetDash(cp.Dash...)
+		for _, pos := range cp.Positions {
+			gc.LineTo(trans.LatLngToXY(pos.LatLng))
+		}
+		gc.Stroke()
+		gc.SetDash()
+		return
+	}
+
 	for i := 1; i < len(cp.Positions); i++ {
-		gc.SetColor(cp.Positions[i-1].Color)
+		gc.SetColor(cp.color(i - 1))
 		spx, spy := trans.LatLngToXY(cp.Positions[i-1].LatLng)
 		epx, epy := trans.LatLngToXY(cp.Positions[i].LatLng)
 		gc.DrawLine(spx, spy, epx, epy)
@@ -68,3 +100,43 @@ func (cp *ColorPath) Draw(gc *gg.Context, trans *sm.Transformer) {
 	}
 	gc.Stroke()
 }
+
+// DrawCanvas draws the colorpath on any canvas.  Each run of points with the
+// same color is a single line, so a path in one color is a single element in a
+// vector document.
+func (cp *ColorPath) DrawCanvas(c canvas.Canvas, project canvas.Projection) {
+	if len(cp.Positions) <= 1 {
+		return
+	}
+	if len(cp.Dash) > 0 {
+		xy := []float64{}
+		for _, pos := range cp.Positions {
+			x, y := project(pos.LatLng)
+			xy = append(xy, x, y)
+		}
+		c.Polyline(xy, cp.color(0), cp.Weight, cp.Dash)
+		return
+	}
+
+	// like Draw, each line between two points is the color of the first point
+	x, y := project(cp.Positions[0].LatLng)
+	xy := []float64{x, y}
+	for i := 1; i < len(cp.Positions); i++ {
+		x, y := project(cp.Positions[i].LatLng)
+		xy = append(xy, x, y)
+		if i == len(cp.Positions)-1 || cp.Positions[i].Color != cp.Positions[i-1].Color {
+			c.Polyline(xy, cp.color(i-1), cp.Weight, nil)
+			xy = []float64{x, y}
+		}
+	}
+}
+
+// color is the color of point i, with the path's fade
+func (cp *ColorPath) color(i int) color.Color {
+	c := cp.Positions[i].Color
+	if cp.Fade <= 0 {
+		return c
+	}
+	r, g, b := c.RGB255()
+	return color.NRGBA{R: r, G: g, B: b, A: uint8(math.Round(255 * (1 - math.Min(cp.Fade, 1))))}
+}
@@ -1,12 +1,15 @@
 package colorpath
 
 import (
+	"image"
 	"image/color"
 	"testing"
 
 	sm "github.com/flopp/go-staticmaps"
+	"github.com/fogleman/gg"
 	"github.com/golang/geo/s2"
 	"github.com/lucasb-eyer/go-colorful"
+	"github.com/meekmichael/gpxrainbow/canvas"
 	"github.com/meekmichael/gpxrainbow/tile"
 	"github.com/stretchr/testify/assert"
 )
@@ -75,3 +78,81 @@ func TestColorPath_Draw(t *testing.T) {
 		})
 	}
 }
+
+// lineCanvas records the lines drawn on it
+type lineCanvas struct {
+	canvas.Canvas
+	lines []line
+}
+
+type line struct {
+	xy     []float64
+	stroke color.Color
+	dash   []float64
+}
+
+func (c *lineCanvas) Polyline(xy []float64, stroke color.Color, width float64, dash []float64) {
+	c.lines = append(c.lines, line{xy: xy, stroke: stroke, dash: dash})
+}
+
+func dashedPath() *ColorPath {
+	cp := NewColorPath(4)
+	cp.Dash = []float64{12, 8}
+	for i, c := range []colorful.Color{{R: 1}, {G: 1}, {B: 1}} {
+		cp.Positions = append(cp.Positions, Point{
+			LatLng: s2.LatLngFromDegrees(45+0.002*float64(i), 45+0.004*float64(i%2)),
+			Color:  c,
+		})
+	}
+	return cp
+}
+
+// TestColorPath_Dashed checks a dashed path is one line in the color of its
+// first point
+func TestColorPath_Dashed(t *testing.T) {
+	cp := dashedPath()
+	c := &lineCanvas{}
+	cp.DrawCanvas(c, func(ll s2.LatLng) (float64, float64) { return ll.Lng.Degrees(), ll.Lat.Degrees() })
+	assert.Len(t, c.lines, 1)
+	assert.Len(t, c.lines[0].xy, 6)
+	assert.Equal(t, colorful.Color{R: 1}, c.lines[0].stroke)
+	assert.Equal(t, cp.Dash, c.lines[0].dash)
+
+	ctx := sm.NewContext()
+	ctx.SetSize(128, 128)
+	ctx.SetTileProvider(&sm.TileProvider{TileSize: 256})
+	ctx.SetZoom(15)
+	center := s2.LatLngFromDegrees(45.002, 45.002)
+	ctx.SetCenter(center)
+	trans, err := ctx.Transformer()
+	assert.NoError(t, err)
+	// the transformer's pixels are on the whole tiles around the center
+	cx, cy := trans.LatLngToXY(center)
+	gc := gg.NewContext(128, 128)
+	gc.Translate(64-cx, 64-cy)
+	cp.Draw(gc, trans)
+	img := gc.Image().(*image.RGBA)
+	drawn, clear := 0, 0
+	for y := 0; y < 128; y++ {
+		for x := 0; x < 128; x++ {
+			px := img.RGBAAt(x, y)
+			if px.A == 0 {
+				continue
+			}
+			drawn++
+			// anti-aliased edges are see through red, never green or blue
+			assert.True(t, px.G == 0 && px.B == 0, "%v at %d, %d", px, x, y)
+		}
+	}
+	assert.True(t, drawn > 100, "%d pixels drawn", drawn)
+	// the gaps between dashes aren't drawn
+	x0, y0 := trans.LatLngToXY(cp.Positions[0].LatLng)
+	x1, y1 := trans.LatLngToXY(cp.Positions[1].LatLng)
+	x0, y0, x1, y1 = x0+64-cx, y0+64-cy, x1+64-cx, y1+64-cy
+	for s := 0.0; s <= 1; s += 0.01 {
+		if img.RGBAAt(int(x0+(x1-x0)*s), int(y0+(y1-y0)*s)).A == 0 {
+			clear++
+		}
+	}
+	assert.True(t, clear > 10, "%d gaps on the line", clear)
+}
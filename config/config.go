@@ -3,33 +3,141 @@ package config
 import (
 	"errors"
 	"fmt"
+	"math"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/meekmichael/gpxrainbow/filter"
 	"github.com/meekmichael/gpxrainbow/tile"
+	"github.com/tkrajina/gpxgo/gpx"
 	"github.com/urfave/cli/v2"
 )
 
+// Options are the settings for rendering a map, as plain values so they can be
+// filled in by the command line or by another Go program.  Use DefaultOptions to
+// start from the same defaults as the command line.
+type Options struct {
+	Animation         string  // ANIMATION_PROGRESSIVE or ANIMATION_RACE, animated output only
+	DPI               int     // PDF output only
+	Duration          float64 // seconds, animated output only
+	FPS               int     // animated output only
+	FTP               int     // watts, 0 = off
+	Fade              float64 // seconds for drawn lines to fade out, 0 = off, animated output only
+	FilterAccel       float64 // meters/second^2, 0 = off
+	FilterDistance    float64 // meters, 0 = off
+	FilterDuplicates  bool
+	FilterSpeed       float64 // kph or mph depending on Units, 0 = off
+	Format            string  // one of the FORMAT_ constants, "" = from the output file's extension
+	GradeWindow       int     // meters
+	Height            int
+	Landscape         bool // PDF output only
+	LineWidth         int
+	Margin            float64 // mm, PDF output only
+	Max               string  // in legend units, or m:ss in pace mode, "" = off
+	Min               string  // in legend units, or m:ss in pace mode, "" = off
+	Mode              string
+	NoWaypoints       bool
+	OutputFile        string // only needed for the command line
+	PageSize          string // a paper size name or WxH in mm or in, PDF output only
+	ProximityDistance int    // meters
+	Routes            string // ROUTES_PLANNED, ROUTES_TRACK or ROUTES_NONE
+	ScaleClip         string // "low,high" percentiles, "" = off
+	SlowestPace       string // m:ss
+	TileProvider      string // tile.NONE for no basemap
+	Timezone          string
+	Units             string
+	Width             int
+	WorldFile         bool   // write a world file and .prj beside a .png or .jpg
+	ZoomRange         string // "min-max" or one zoom level, tile pyramid output only
+}
+
+// DefaultOptions are the defaults used by the command line
+func DefaultOptions() Options {
+	return Options{
+		Animation:         ANIMATION_PROGRESSIVE,
+		DPI:               150,
+		Duration:          10,
+		FPS:               15,
+		GradeWindow:       50,
+		Height:            1536,
+		LineWidth:         3,
+		Margin:            10,
+		Mode:              MODE_PROXIMITY,
+		OutputFile:        "output.png",
+		PageSize:          "a4",
+		ProximityDistance: 10,
+		Routes:            ROUTES_PLANNED,
+		SlowestPace:       "15:00",
+		TileProvider:      "carto-light",
+		Timezone:          "Local",
+		Units:             "metric",
+		Width:             2048,
+		ZoomRange:         "10-16",
+	}
+}
+
 // MapConfig is global configuration state
 type MapConfig struct {
+	Animation         string
+	ClipHigh          float64 // percentile
+	ClipLow           float64 // percentile
+	DPI               int
+	Duration          float64 // seconds
+	FPS               int
+	FTP               int
+	Fade              float64 // seconds
+	Filter            filter.Options
+	Format            string
+	GradeWindow       uint16
 	ImageHeight       int
 	ImageWidth        int
 	LineWidth         uint16
 	Mode              string
+	NoWaypoints       bool
 	OutputFile        string
+	PageHeight        float64 // points, with the margins taken off
+	PageMargin        float64 // points
+	PageWidth         float64 // points, with the margins taken off
 	ProximityDistance uint16
+	Routes            string
+	ScaleMax          gpx.NullableFloat64 // in the same units as the Min/Max fields below
+	ScaleMin          gpx.NullableFloat64
+	SlowestPace       float64 // seconds per meter
 	TileProvider      string
+	Timezone          *time.Location
 	Units             string
+	WorldFile         bool
+	ZoomMax           int
+	ZoomMin           int
 
 	// set at runtime
+	MaxCadence   float64
 	MaxElevation float64
+	MaxGrade     float64
+	MaxHeartRate float64
+	MaxPace      float64
+	MaxPower     float64
 	MaxSpeed     float64
+	MaxStart     time.Time
+	MinCadence   float64
 	MinElevation float64
+	MinHeartRate float64
+	MinPace      float64
+	MinPower     float64
+	MinSpeed     float64
+	MinStart     time.Time
 }
 
 // MODE_PROXIMITY color path based on number of proximity to this pixel
 const MODE_PROXIMITY = "proximity"
 
+// MODE_OVERLAP color path based on how many other paths pass near this pixel,
+// regardless of the order files were read in
+const MODE_OVERLAP = "overlap"
+
 // MODE_INPUT color path based on the order files were read in
 const MODE_INPUT = "input"
 
@@ -39,68 +147,580 @@ const MODE_SPEED = "speed"
 // MODE_ELEVATION color path by elevation
 const MODE_ELEVATION = "elevation"
 
+// MODE_HEARTRATE color path by heart rate from the GPX point extensions
+const MODE_HEARTRATE = "heartrate"
+
+// MODE_CADENCE color path by cadence from the GPX point extensions
+const MODE_CADENCE = "cadence"
+
+// MODE_POWER color path by power from the GPX point extensions
+const MODE_POWER = "power"
+
+// MODE_DATE color each path by the date it was started
+const MODE_DATE = "date"
+
+// MODE_GRADE color path by the percent grade of the slope
+const MODE_GRADE = "grade"
+
+// MODE_TIMEOFDAY color path by the local time of day
+const MODE_TIMEOFDAY = "timeofday"
+
+// MODE_PACE color path by pace (time per distance), for runners
+const MODE_PACE = "pace"
+
+// ROUTES_PLANNED draw GPX routes as dashed lines, a plan to compare the tracks to
+const ROUTES_PLANNED = "planned"
+
+// ROUTES_TRACK draw GPX routes like tracks, colored by the mode
+const ROUTES_TRACK = "track"
+
+// ROUTES_NONE don't draw GPX routes
+const ROUTES_NONE = "none"
+
+// ANIMATION_PROGRESSIVE draw the tracks in the order they were recorded
+const ANIMATION_PROGRESSIVE = "progressive"
+
+// ANIMATION_RACE start every track at once, like a race
+const ANIMATION_RACE = "race"
+
+// FORMAT_PNG write a PNG image
+const FORMAT_PNG = "png"
+
+// FORMAT_JPG write a JPEG image
+const FORMAT_JPG = "jpg"
+
+// FORMAT_SVG write an SVG document with the basemap as an image
+const FORMAT_SVG = "svg"
+
+// FORMAT_PDF write a page for printing
+const FORMAT_PDF = "pdf"
+
+// FORMAT_GIF write an animated GIF
+const FORMAT_GIF = "gif"
+
+// FORMAT_APNG write an animated PNG
+const FORMAT_APNG = "apng"
+
+// FORMAT_HTML write a web page with the map on it
+const FORMAT_HTML = "html"
+
+// FORMAT_GEOJSON write the colored paths as GeoJSON data
+const FORMAT_GEOJSON = "geojson"
+
+// FORMAT_KML write the colored paths as KML data
+const FORMAT_KML = "kml"
+
+// FORMAT_TILES write a directory of z/x/y.png overlay tiles for a web map
+const FORMAT_TILES = "tiles"
+
+// outputFormats are the formats of the output files we can write, by extension
+var outputFormats = map[string]string{
+	".apng":    FORMAT_APNG,
+	".geojson": FORMAT_GEOJSON,
+	".gif":     FORMAT_GIF,
+	".htm":     FORMAT_HTML,
+	".html":    FORMAT_HTML,
+	".kml":     FORMAT_KML,
+	".jpeg":    FORMAT_JPG,
+	".jpg":     FORMAT_JPG,
+	".pdf":     FORMAT_PDF,
+	".png":     FORMAT_PNG,
+	".svg":     FORMAT_SVG,
+}
+
+// framePattern is the frame number in a file name for a sequence of frames,
+// the way ffmpeg takes them
+var framePattern = regexp.MustCompile(`%0?[0-9]*d`)
+
+// pageSizes are the paper sizes in mm
+var pageSizes = map[string][2]float64{
+	"a0":      {841, 1189},
+	"a1":      {594, 841},
+	"a2":      {420, 594},
+	"a3":      {297, 420},
+	"a4":      {210, 297},
+	"a5":      {148, 210},
+	"letter":  {215.9, 279.4},
+	"legal":   {215.9, 355.6},
+	"tabloid": {279.4, 431.8},
+}
+
+const mmPerInch = 25.4
+
+const pageSizeError = "invalid page_size %q, use a4, letter etc. or a size like \"300x200mm\" or \"11x17in\""
+
 const maxheight = 16 * 1024
 const maxwidth = 16 * 1024
 const minheight = 64
 const minwidth = 64
 const minlinewidth = 1
 const maxlinewidth = 32
+const maxftp = 1000
+const mingradewindow = 1
+const maxgradewindow = 1000
 const minproximity = 1
 const maxproximity = 1000
+const mindpi = 36
+const maxdpi = 600
+const minfps = 1
+const maxfps = 50
+const maxframes = 10000
+const maxzoom = 20
 
-// NewConfig validates inputs and builds a config struct
+// NewConfig validates the command line and builds a config struct
 func NewConfig(c *cli.Context) (MapConfig, error) {
 	if c.Bool("list-tileprovider") {
 		tile.ListTileProvider()
 	}
+	if c.String("outputfile") == "" {
+		return MapConfig{}, errors.New("please give an output file")
+	}
+	outfile := c.String("outputfile")
+	if format := strings.ToLower(c.String("format")); format != "" && !c.IsSet("outputfile") {
+		outfile = "output." + format
+		if format == FORMAT_TILES {
+			outfile = "tiles"
+		}
+	}
 	tp := c.String("tileprovider")
+	if c.Bool("no_basemap") {
+		tp = tile.NONE
+	}
+	opts := Options{
+		Animation:         c.String("animation"),
+		DPI:               c.Int("dpi"),
+		Duration:          c.Float64("duration"),
+		FPS:               c.Int("fps"),
+		FTP:               c.Int("ftp"),
+		Fade:              c.Float64("fade"),
+		FilterAccel:       c.Float64("filter_accel"),
+		FilterDistance:    c.Float64("filter_distance"),
+		FilterDuplicates:  c.Bool("filter_duplicates"),
+		FilterSpeed:       c.Float64("filter_speed"),
+		Format:            c.String("format"),
+		GradeWindow:       c.Int("grade_window"),
+		Height:            c.Int("height"),
+		Landscape:         c.Bool("landscape"),
+		LineWidth:         c.Int("linewidth"),
+		Margin:            c.Float64("margin"),
+		Max:               c.String("max"),
+		Min:               c.String("min"),
+		Mode:              c.String("mode"),
+		NoWaypoints:       c.Bool("no_waypoints"),
+		OutputFile:        outfile,
+		PageSize:          c.String("page_size"),
+		ProximityDistance: c.Int("proximity_distance"),
+		Routes:            c.String("routes"),
+		ScaleClip:         c.String("scale_clip"),
+		SlowestPace:       c.String("slowest_pace"),
+		TileProvider:      tp,
+		Timezone:          c.String("timezone"),
+		Units:             c.String("units"),
+		Width:             c.Int("width"),
+		WorldFile:         c.Bool("world_file"),
+		ZoomRange:         c.String("zoom_range"),
+	}
+	if err := checkGiven(opts, c.IsSet); err != nil {
+		return MapConfig{}, err
+	}
+	return New(opts)
+}
+
+// checkGiven checks the animation and PDF flags that were given, as New passes
+// over bad values in formats that don't use them, so a typo isn't dropped
+// without a word
+func checkGiven(opts Options, isSet func(name string) bool) error {
+	if isSet("animation") || isSet("fps") || isSet("duration") || isSet("fade") {
+		if _, _, _, _, err := animationOptions(opts); err != nil {
+			return err
+		}
+	}
+	if isSet("dpi") || isSet("page_size") || isSet("margin") {
+		if _, _, _, _, err := pageOptions(opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// New validates options and builds a config struct
+func New(opts Options) (MapConfig, error) {
+	tp := opts.TileProvider
 	if !tile.ValidateTileProvider(tp) {
 		return MapConfig{}, fmt.Errorf("invalid tileprovider, use --list-tileprovider to get a list")
 	}
-	height := c.Int("height")
+	outfile := ""
+	if opts.OutputFile != "" {
+		outfile = filepath.Clean(opts.OutputFile)
+	}
+	format := strings.ToLower(opts.Format)
+	if format == "" && outfile != "" {
+		if format = outputFormats[strings.ToLower(filepath.Ext(outfile))]; format == "" {
+			return MapConfig{}, errors.New("the output file must be a .png, .jpg, .svg, .pdf, .gif, .apng, .html, .geojson or .kml, or pick its --format")
+		}
+	} else if format == "" {
+		format = FORMAT_PNG
+	} else if !validFormat(format) && format != FORMAT_TILES {
+		return MapConfig{}, errors.New("format must be one of png, jpg, svg, pdf, gif, apng, html, geojson, kml, tiles")
+	}
+
+	if opts.WorldFile && (outfile == "" || (format != FORMAT_PNG && format != FORMAT_JPG) || FrameSequence(outfile)) {
+		return MapConfig{}, errors.New("world_file needs a .png or .jpg output file")
+	}
+
+	// the animation and PDF options are only checked when making one, for
+	// other formats a bad value falls back to the default so it can't stop a
+	// map that doesn't use it, NewConfig checks the flags given on their own
+	animated := format == FORMAT_GIF || format == FORMAT_APNG || FrameSequence(outfile)
+	animation, fps, duration, fade, err := animationOptions(opts)
+	if err != nil && animated {
+		return MapConfig{}, err
+	} else if err != nil {
+		if animation, fps, duration, fade, err = animationOptions(DefaultOptions()); err != nil {
+			return MapConfig{}, err
+		}
+	}
+	dpi, pageWidth, pageHeight, margin, err := pageOptions(opts)
+	if err != nil && format == FORMAT_PDF {
+		return MapConfig{}, err
+	} else if err != nil {
+		if dpi, pageWidth, pageHeight, margin, err = pageOptions(DefaultOptions()); err != nil {
+			return MapConfig{}, err
+		}
+	}
+	if tp == tile.NONE && (format == FORMAT_JPG || format == FORMAT_GIF) {
+		return MapConfig{}, errors.New("without a basemap the map is transparent, which a .jpg or .gif can't be")
+	}
+	if FrameSequence(outfile) && format != FORMAT_PNG {
+		return MapConfig{}, errors.New("frames of an animation are written as .png files")
+	}
+
+	zoomMin, zoomMax, _ := parseZoomRange(DefaultOptions().ZoomRange)
+	if format == FORMAT_TILES {
+		if zoomMin, zoomMax, err = parseZoomRange(opts.ZoomRange); err != nil {
+			return MapConfig{}, err
+		}
+	}
+
+	height := opts.Height
+	width := opts.Width
+	if format == FORMAT_PDF {
+		// the page decides the size of a PDF
+		width = int(pageWidth * float64(dpi) / 72)
+		height = int(pageHeight * float64(dpi) / 72)
+		if width < minwidth || height < minheight || width > maxwidth || height > maxheight {
+			return MapConfig{}, fmt.Errorf("the page inside its margins is %dx%d pixels at %d dpi, it must be from %dx%d to %dx%d",
+				width, height, dpi, minwidth, minheight, maxwidth, maxheight)
+		}
+	}
 	if height < minheight || height > maxheight {
 		return MapConfig{}, fmt.Errorf("Please use a height between %d and %d", minheight, maxheight)
 	}
-	width := c.Int("width")
 	if width < minwidth || width > maxwidth {
 		return MapConfig{}, fmt.Errorf("Please use a width between %d and %d", minwidth, maxwidth)
 	}
-	lineWidth := c.Int("linewidth")
+	lineWidth := opts.LineWidth
 	if lineWidth < minlinewidth || lineWidth > maxlinewidth {
 		return MapConfig{}, fmt.Errorf("Please use a line width between %d and %d", minlinewidth, maxlinewidth)
 	}
-	proxDistance := c.Int("proximity_distance")
+	proxDistance := opts.ProximityDistance
 	if proxDistance < minproximity || proxDistance > maxproximity {
 		return MapConfig{}, fmt.Errorf("Please use a proximity_distance between %d and %d", minproximity, maxproximity)
 	}
-	mode := c.String("mode")
-	if _, ok := map[string]bool{MODE_PROXIMITY: true, MODE_INPUT: true, MODE_SPEED: true, MODE_ELEVATION: true}[strings.ToLower(mode)]; !ok {
-		return MapConfig{}, errors.New("Please pick a valid mode, one of proximity, input, speed, elevation")
+	mode := strings.ToLower(opts.Mode)
+	if _, ok := map[string]bool{MODE_PROXIMITY: true, MODE_OVERLAP: true, MODE_INPUT: true, MODE_SPEED: true, MODE_ELEVATION: true, MODE_HEARTRATE: true, MODE_CADENCE: true, MODE_POWER: true, MODE_DATE: true, MODE_GRADE: true, MODE_TIMEOFDAY: true, MODE_PACE: true}[mode]; !ok {
+		return MapConfig{}, errors.New("Please pick a valid mode, one of proximity, overlap, input, speed, elevation, heartrate, cadence, power, date, grade, timeofday, pace")
 	}
-	units := strings.ToLower(c.String("units"))
+	routes := strings.ToLower(opts.Routes)
+	if routes != ROUTES_PLANNED && routes != ROUTES_TRACK && routes != ROUTES_NONE {
+		return MapConfig{}, errors.New("routes must be \"planned\", \"track\" or \"none\"")
+	}
+	ftp := opts.FTP
+	if ftp < 0 || ftp > maxftp {
+		return MapConfig{}, fmt.Errorf("Please use an ftp between 0 (off) and %d watts", maxftp)
+	}
+	gradeWindow := opts.GradeWindow
+	if gradeWindow < mingradewindow || gradeWindow > maxgradewindow {
+		return MapConfig{}, fmt.Errorf("Please use a grade_window between %d and %d", mingradewindow, maxgradewindow)
+	}
+	timezone, err := time.LoadLocation(opts.Timezone)
+	if err != nil {
+		return MapConfig{}, fmt.Errorf("invalid timezone, use a name like \"America/Chicago\": %v", err)
+	}
+	units := strings.ToLower(opts.Units)
 	if units != "us" && units != "metric" {
 		return MapConfig{}, errors.New("units must be \"us\" or \"metric\"")
 	}
+	slowestPace, err := ParsePace(opts.SlowestPace)
+	if err != nil || slowestPace <= 0 {
+		return MapConfig{}, errors.New("slowest_pace must be a pace like \"15:00\" (minutes:seconds per km, or per mile for us units)")
+	}
+	slowestPace /= UnitDistance(units)
+	speedUnit := 3.6 // kph
+	if units == "us" {
+		speedUnit = 2.236936 // mph
+	}
+	filterOpts := filter.Options{
+		Duplicates:  opts.FilterDuplicates,
+		MaxAccel:    opts.FilterAccel,
+		MaxSpeed:    opts.FilterSpeed / speedUnit,
+		MinDistance: opts.FilterDistance,
+	}
+	if filterOpts.MaxAccel < 0 || filterOpts.MaxSpeed < 0 || filterOpts.MinDistance < 0 {
+		return MapConfig{}, errors.New("filter thresholds can't be negative, use 0 to turn a filter off")
+	}
 
-	outfile := filepath.Clean(c.String("outputfile"))
-
-	if !strings.HasSuffix(outfile, ".png") &&
-		!strings.HasSuffix(outfile, ".jpg") &&
-		!strings.HasSuffix(outfile, ".jpeg") &&
-		!strings.HasSuffix(outfile, ".PNG") &&
-		!strings.HasSuffix(outfile, ".JPG") &&
-		!strings.HasSuffix(outfile, ".JPEG") {
-		return MapConfig{}, errors.New("only png and jpeg are supported for the output image")
+	clipLow, clipHigh := 0.0, 100.0
+	if clip := opts.ScaleClip; clip != "" {
+		parts := strings.Split(clip, ",")
+		ok := len(parts) == 2
+		if ok {
+			var errLow, errHigh error
+			clipLow, errLow = strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+			clipHigh, errHigh = strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+			ok = errLow == nil && errHigh == nil && clipLow >= 0 && clipLow < clipHigh && clipHigh <= 100
+		}
+		if !ok {
+			return MapConfig{}, errors.New("scale_clip must be two percentiles like \"2,98\"")
+		}
 	}
 
-	return MapConfig{
+	conf := MapConfig{
+		Animation:         animation,
+		ClipHigh:          clipHigh,
+		ClipLow:           clipLow,
+		DPI:               dpi,
+		Duration:          duration,
+		FPS:               fps,
+		FTP:               ftp,
+		Fade:              fade,
+		Filter:            filterOpts,
+		Format:            format,
+		GradeWindow:       uint16(gradeWindow),
 		ImageHeight:       height,
 		ImageWidth:        width,
 		LineWidth:         uint16(lineWidth),
 		Mode:              mode,
+		NoWaypoints:       opts.NoWaypoints,
 		OutputFile:        outfile,
+		PageHeight:        pageHeight,
+		PageMargin:        margin,
+		PageWidth:         pageWidth,
 		ProximityDistance: uint16(proxDistance),
+		Routes:            routes,
+		SlowestPace:       slowestPace,
 		TileProvider:      tp,
+		Timezone:          timezone,
 		Units:             units,
-	}, nil
+		WorldFile:         opts.WorldFile,
+		ZoomMax:           zoomMax,
+		ZoomMin:           zoomMin,
+	}
+	if conf.ScaleMin, err = conf.parseScaleValue(opts.Min); err != nil {
+		return MapConfig{}, fmt.Errorf("invalid --min: %v", err)
+	}
+	if conf.ScaleMax, err = conf.parseScaleValue(opts.Max); err != nil {
+		return MapConfig{}, fmt.Errorf("invalid --max: %v", err)
+	}
+	if conf.ScaleMin.NotNull() && conf.ScaleMax.NotNull() && conf.ScaleMin.Value() >= conf.ScaleMax.Value() {
+		return MapConfig{}, errors.New("--min must be less than --max")
+	}
+	if conf.ScaleMin.NotNull() || conf.ScaleMax.NotNull() {
+		switch mode {
+		case MODE_PROXIMITY, MODE_OVERLAP, MODE_INPUT, MODE_DATE, MODE_TIMEOFDAY:
+			return MapConfig{}, fmt.Errorf("--min and --max don't apply to %s mode", mode)
+		case MODE_GRADE:
+			// the grade scale is centered on 0%, either end sets both
+			if conf.ScaleMin.NotNull() && conf.ScaleMax.NotNull() && conf.ScaleMin.Value() != -conf.ScaleMax.Value() {
+				return MapConfig{}, errors.New("in grade mode the scale is centered on 0%, --min must be minus --max")
+			}
+		}
+	}
+	return conf, nil
+}
+
+// animationOptions checks the options of animated output
+func animationOptions(opts Options) (string, int, float64, float64, error) {
+	animation := strings.ToLower(opts.Animation)
+	if animation != ANIMATION_PROGRESSIVE && animation != ANIMATION_RACE {
+		return "", 0, 0, 0, errors.New("animation must be \"progressive\" or \"race\"")
+	}
+	fps := opts.FPS
+	if fps < minfps || fps > maxfps {
+		return "", 0, 0, 0, fmt.Errorf("Please use an fps between %d and %d", minfps, maxfps)
+	}
+	if opts.Duration <= 0 || opts.Duration*float64(fps) > maxframes {
+		return "", 0, 0, 0, fmt.Errorf("the duration must be more than 0 and make at most %d frames at the fps", maxframes)
+	}
+	if opts.Fade < 0 {
+		return "", 0, 0, 0, errors.New("fade can't be negative, use 0 to turn it off")
+	}
+	return animation, fps, opts.Duration, opts.Fade, nil
+}
+
+// pageOptions checks the options of PDF output, returning the dpi, and the
+// page size inside the margins and the margin in points
+func pageOptions(opts Options) (int, float64, float64, float64, error) {
+	dpi := opts.DPI
+	if dpi < mindpi || dpi > maxdpi {
+		return 0, 0, 0, 0, fmt.Errorf("Please use a dpi between %d and %d", mindpi, maxdpi)
+	}
+	pageWidth, pageHeight, err := ParsePageSize(opts.PageSize)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+	if opts.Landscape && pageWidth < pageHeight {
+		pageWidth, pageHeight = pageHeight, pageWidth
+	}
+	margin := opts.Margin * 72 / mmPerInch
+	if margin < 0 {
+		return 0, 0, 0, 0, errors.New("the margin can't be negative")
+	}
+	return dpi, pageWidth - 2*margin, pageHeight - 2*margin, margin, nil
+}
+
+// DisplayScale is what the mode's values are multiplied by to get the units shown
+// in the legend, e.g. meters/second to kph
+func (c MapConfig) DisplayScale() float64 {
+	switch c.Mode {
+	case MODE_SPEED:
+		if c.Units == "us" {
+			return 2.236936 // meters/s -> mph
+		}
+		return 3.6 // meters/s -> kph
+	case MODE_ELEVATION:
+		if c.Units == "us" {
+			return 3.2808399 // meters -> feet
+		}
+	case MODE_POWER:
+		if c.FTP > 0 {
+			return 100 / float64(c.FTP) // watts -> % of FTP
+		}
+	case MODE_PACE:
+		return UnitDistance(c.Units) // seconds/meter -> seconds/km or mile
+	}
+	return 1
+}
+
+// parseScaleValue parses a --min or --max given in legend units, or a m:ss pace
+// in pace mode, into the units the mode works in
+func (c MapConfig) parseScaleValue(s string) (gpx.NullableFloat64, error) {
+	if s == "" {
+		return gpx.NullableFloat64{}, nil
+	}
+	var v float64
+	var err error
+	if c.Mode == MODE_PACE {
+		v, err = ParsePace(s)
+	} else {
+		v, err = strconv.ParseFloat(s, 64)
+	}
+	if err != nil {
+		return gpx.NullableFloat64{}, err
+	}
+	return *gpx.NewNullableFloat64(v / c.DisplayScale()), nil
+}
+
+// validFormat is whether format is one of the FORMAT_ constants
+func validFormat(format string) bool {
+	for _, f := range outputFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// Basemap is whether the map is drawn over the tile provider's tiles
+func (c MapConfig) Basemap() bool {
+	return c.TileProvider != tile.NONE
+}
+
+// Frames is the number of frames in an animation
+func (c MapConfig) Frames() int {
+	return int(math.Max(1, math.Round(c.Duration*float64(c.FPS))))
+}
+
+// FrameSequence is whether filename is a pattern like "frames/%04d.png" for
+// writing the frames of an animation to separate files
+func FrameSequence(filename string) bool {
+	return framePattern.MatchString(filepath.Base(filename))
+}
+
+// FrameFile is the file name for frame i of a FrameSequence pattern
+func FrameFile(pattern string, i int) string {
+	dir, base := filepath.Split(pattern)
+	loc := framePattern.FindStringIndex(base)
+	return dir + base[:loc[0]] + fmt.Sprintf(base[loc[0]:loc[1]], i) + base[loc[1]:]
+}
+
+// PageImageSize is the size in pixels of a map filling the page inside its
+// margins, at the DPI
+func (c MapConfig) PageImageSize() (int, int) {
+	return int(c.PageWidth * float64(c.DPI) / 72), int(c.PageHeight * float64(c.DPI) / 72)
+}
+
+// ParsePageSize parses a paper size name like "a4" or "letter", or a size like
+// "300x200mm" or "11x17in", into its width and height in points
+func ParsePageSize(s string) (float64, float64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if size, ok := pageSizes[s]; ok {
+		return size[0] * 72 / mmPerInch, size[1] * 72 / mmPerInch, nil
+	}
+	unit := 72 / mmPerInch
+	if strings.HasSuffix(s, "in") {
+		unit = 72
+	} else if !strings.HasSuffix(s, "mm") {
+		return 0, 0, fmt.Errorf(pageSizeError, s)
+	}
+	parts := strings.Split(s[:len(s)-2], "x")
+	if len(parts) == 2 {
+		w, errW := strconv.ParseFloat(parts[0], 64)
+		h, errH := strconv.ParseFloat(parts[1], 64)
+		if errW == nil && errH == nil && w > 0 && h > 0 {
+			return w * unit, h * unit, nil
+		}
+	}
+	return 0, 0, fmt.Errorf(pageSizeError, s)
+}
+
+// parseZoomRange parses zoom levels like "10-16", or one level like "14"
+func parseZoomRange(s string) (int, int, error) {
+	parts := strings.SplitN(strings.TrimSpace(s), "-", 2)
+	min, errMin := strconv.Atoi(strings.TrimSpace(parts[0]))
+	max, errMax := min, errMin
+	if len(parts) == 2 {
+		max, errMax = strconv.Atoi(strings.TrimSpace(parts[1]))
+	}
+	if errMin != nil || errMax != nil || min < 0 || max > maxzoom || min > max {
+		return 0, 0, fmt.Errorf("zoom_range must be like \"10-16\", from 0 to %d", maxzoom)
+	}
+	return min, max, nil
+}
+
+// UnitDistance is the meters in a km or mile, the distance paces are given over
+func UnitDistance(units string) float64 {
+	if units == "us" {
+		return 1609.344
+	}
+	return 1000
+}
+
+// ParsePace parses a "m:ss" pace into seconds
+func ParsePace(s string) (float64, error) {
+	parts := strings.SplitN(s, ":", 2)
+	min, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, err
+	}
+	sec := 0
+	if len(parts) == 2 {
+		if sec, err = strconv.Atoi(parts[1]); err != nil {
+			return 0, err
+		}
+		if sec < 0 || sec >= 60 {
+			return 0, fmt.Errorf("invalid seconds in pace %q", s)
+		}
+	}
+	return float64(min*60 + sec), nil
 }
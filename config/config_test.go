@@ -0,0 +1,107 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/meekmichael/gpxrainbow/tile"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	conf, err := New(DefaultOptions())
+	assert.NoError(t, err)
+	assert.Equal(t, MODE_PROXIMITY, conf.Mode)
+	assert.Equal(t, FORMAT_PNG, conf.Format)
+
+	// modes, units and formats are case-insensitive
+	opts := DefaultOptions()
+	opts.Mode = "Speed"
+	opts.Units = "US"
+	opts.OutputFile = "map.PDF"
+	conf, err = New(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, MODE_SPEED, conf.Mode)
+	assert.Equal(t, "us", conf.Units)
+	assert.Equal(t, FORMAT_PDF, conf.Format)
+	assert.InDelta(t, 2.236936, conf.DisplayScale(), 1e-6)
+}
+
+func TestNewErrors(t *testing.T) {
+	for name, change := range map[string]func(*Options){
+		"mode":               func(o *Options) { o.Mode = "rainbow" },
+		"units":              func(o *Options) { o.Units = "imperial" },
+		"tileprovider":       func(o *Options) { o.TileProvider = "nowhere" },
+		"output file":        func(o *Options) { o.OutputFile = "map.bmp" },
+		"format":             func(o *Options) { o.Format = "bmp" },
+		"timezone":           func(o *Options) { o.Timezone = "Mars/Olympus" },
+		"width":              func(o *Options) { o.Width = minwidth - 1 },
+		"height":             func(o *Options) { o.Height = maxheight + 1 },
+		"linewidth":          func(o *Options) { o.LineWidth = maxlinewidth + 1 },
+		"proximity_distance": func(o *Options) { o.ProximityDistance = minproximity - 1 },
+		"slowest_pace":       func(o *Options) { o.SlowestPace = "fast" },
+		"filter":             func(o *Options) { o.FilterSpeed = -1 },
+		"scale_clip":         func(o *Options) { o.ScaleClip = "98,2" },
+		"min":                func(o *Options) { o.Mode, o.Min = MODE_SPEED, "slow" },
+		"min over max":       func(o *Options) { o.Mode, o.Min, o.Max = MODE_SPEED, "20", "10" },
+		"min in date mode":   func(o *Options) { o.Mode, o.Min = MODE_DATE, "10" },
+		"asymmetric grade":   func(o *Options) { o.Mode, o.Min, o.Max = MODE_GRADE, "-5", "10" },
+		"world file":         func(o *Options) { o.OutputFile, o.WorldFile = "map.svg", true },
+	} {
+		opts := DefaultOptions()
+		change(&opts)
+		_, err := New(opts)
+		assert.Error(t, err, name)
+	}
+}
+
+// TestNoBasemapFormats checks a map without a basemap is only written in formats
+// that can be see through
+func TestNoBasemapFormats(t *testing.T) {
+	opts := DefaultOptions()
+	opts.TileProvider = tile.NONE
+	for _, file := range []string{"map.png", "map.svg", "map.pdf", "map.apng", "map.html"} {
+		opts.OutputFile = file
+		conf, err := New(opts)
+		assert.NoError(t, err, file)
+		assert.False(t, conf.Basemap(), file)
+	}
+	for _, file := range []string{"map.jpg", "map.gif"} {
+		opts.OutputFile = file
+		_, err := New(opts)
+		assert.Error(t, err, file)
+	}
+}
+
+// TestCheckGiven checks a bad animation or PDF flag is an error whenever it's
+// given, while New lets it by for a format that doesn't use it
+func TestCheckGiven(t *testing.T) {
+	for flag, change := range map[string]func(*Options){
+		"fps":       func(o *Options) { o.FPS = 0 },
+		"duration":  func(o *Options) { o.Duration = -1 },
+		"animation": func(o *Options) { o.Animation = "sprint" },
+		"dpi":       func(o *Options) { o.DPI = 5 },
+		"page_size": func(o *Options) { o.PageSize = "b9" },
+		"margin":    func(o *Options) { o.Margin = -1 },
+	} {
+		opts := DefaultOptions()
+		change(&opts)
+		_, err := New(opts)
+		assert.NoError(t, err, flag)
+		assert.Error(t, checkGiven(opts, func(name string) bool { return name == flag }), flag)
+		assert.NoError(t, checkGiven(opts, func(name string) bool { return false }), flag)
+	}
+	assert.NoError(t, checkGiven(DefaultOptions(), func(string) bool { return true }))
+}
+
+func TestParsePace(t *testing.T) {
+	pace, err := ParsePace("5:30")
+	assert.NoError(t, err)
+	assert.Equal(t, 330.0, pace)
+	pace, err = ParsePace("5")
+	assert.NoError(t, err)
+	assert.Equal(t, 300.0, pace)
+	for _, s := range []string{"", "5:60", "a:30", "5:xx"} {
+		_, err := ParsePace(s)
+		assert.Error(t, err, s)
+	}
+}
@@ -0,0 +1,110 @@
+package filter
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/meekmichael/gpxrainbow/track"
+)
+
+// maxJumpRun is how many points in a row can be dropped as jumps before we
+// decide the point we're comparing against was the bad one and start over from
+// the current point
+const maxJumpRun = 10
+
+// Options are the thresholds for dropping bad GPS points, zero turns a check off
+type Options struct {
+	Duplicates  bool    // drop points with the same timestamp as the point before
+	MaxAccel    float64 // meters/second^2
+	MaxSpeed    float64 // meters/second
+	MinDistance float64 // meters
+}
+
+// Stats counts the points dropped for each reason
+type Stats struct {
+	Duplicates int // same timestamp as the point before
+	Jitter     int // closer than MinDistance to the point before
+	Jumps      int // faster than MaxSpeed from the point before
+	Spikes     int // accelerating faster than MaxAccel
+}
+
+// Total is the number of points dropped
+func (s Stats) Total() int {
+	return s.Duplicates + s.Jitter + s.Jumps + s.Spikes
+}
+
+// Add sums two Stats
+func (s Stats) Add(o Stats) Stats {
+	return Stats{
+		Duplicates: s.Duplicates + o.Duplicates,
+		Jitter:     s.Jitter + o.Jitter,
+		Jumps:      s.Jumps + o.Jumps,
+		Spikes:     s.Spikes + o.Spikes,
+	}
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("%d points removed (%d jumps, %d speed spikes, %d duplicate timestamps, %d jitter)",
+		s.Total(), s.Jumps, s.Spikes, s.Duplicates, s.Jitter)
+}
+
+// File drops bad points from every track of a file in place
+func File(opts Options, f *track.File) Stats {
+	stats := Stats{}
+	for t := range f.Tracks {
+		for s := range f.Tracks[t].Segments {
+			var segStats Stats
+			f.Tracks[t].Segments[s].Points, segStats = Segment(opts, f.Tracks[t].Segments[s].Points)
+			stats = stats.Add(segStats)
+		}
+	}
+	return stats
+}
+
+// Segment returns the points of a segment without the ones that are GPS noise:
+// duplicate timestamps, points that barely moved from the last one, and points
+// implying an impossible speed or acceleration.  Only the checks turned on in
+// opts are made.
+func Segment(opts Options, points []track.Point) ([]track.Point, Stats) {
+	stats := Stats{}
+	if len(points) == 0 {
+		return points, stats
+	}
+	kept := []track.Point{points[0]}
+	lastSpeed := math.NaN()
+	jumpRun := 0
+	for i := 1; i < len(points); i++ {
+		last := &kept[len(kept)-1]
+		pt := &points[i]
+		timed := !last.Timestamp.IsZero() && !pt.Timestamp.IsZero()
+		if opts.Duplicates && timed && pt.Timestamp.Equal(last.Timestamp) {
+			stats.Duplicates++
+			continue
+		}
+		dist := pt.Distance2D(last)
+		if dist < opts.MinDistance {
+			stats.Jitter++
+			continue
+		}
+		speed := math.NaN()
+		if timed {
+			seconds := pt.Timestamp.Sub(last.Timestamp).Seconds()
+			speed = dist / math.Abs(seconds)
+			if opts.MaxSpeed > 0 && speed > opts.MaxSpeed && jumpRun < maxJumpRun {
+				stats.Jumps++
+				jumpRun++
+				continue
+			}
+			if opts.MaxAccel > 0 && !math.IsNaN(lastSpeed) && jumpRun < maxJumpRun &&
+				math.Abs(speed-lastSpeed)/math.Abs(seconds) > opts.MaxAccel {
+				stats.Spikes++
+				jumpRun++
+				continue
+			}
+		}
+		jumpRun = 0
+		lastSpeed = speed
+		kept = append(kept, *pt)
+	}
+	return kept, stats
+}
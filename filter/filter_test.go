@@ -0,0 +1,61 @@
+package filter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/meekmichael/gpxrainbow/track"
+	"github.com/stretchr/testify/assert"
+)
+
+func point(lat float64, sec int) track.Point {
+	return track.Point{
+		Latitude:  lat,
+		Longitude: 45,
+		Timestamp: time.Date(2021, 5, 1, 6, 0, sec, 0, time.UTC),
+	}
+}
+
+func TestSegment(t *testing.T) {
+	// ~5.5 meters every second heading north
+	points := []track.Point{
+		point(45.00000, 0),
+		point(45.00005, 1),
+		point(45.00005, 1),   // duplicate timestamp
+		point(45.10000, 2),   // 10km jump
+		point(45.00010, 2),   // fine compared to the point before the jump
+		point(45.000101, 10), // jitter
+		point(45.00015, 11),
+	}
+	for i := range points {
+		points[i].HeartRate.SetValue(float64(100 + i))
+	}
+
+	opts := Options{Duplicates: true, MaxSpeed: 50, MaxAccel: 20, MinDistance: 0.5}
+	kept, stats := Segment(opts, points)
+	assert.Equal(t, Stats{Duplicates: 1, Jitter: 1, Jumps: 1}, stats)
+	assert.Equal(t, 4, len(kept))
+	assert.Equal(t, 104.0, kept[2].HeartRate.Value())
+	assert.Equal(t, 106.0, kept[3].HeartRate.Value())
+
+	// with every check off nothing is dropped
+	kept, stats = Segment(Options{}, points)
+	assert.Equal(t, Stats{}, stats)
+	assert.Equal(t, points, kept)
+
+	// only duplicates, so the jump is kept and the point after it becomes a
+	// duplicate
+	kept, stats = Segment(Options{Duplicates: true}, points)
+	assert.Equal(t, Stats{Duplicates: 2}, stats)
+	assert.Equal(t, 5, len(kept))
+}
+
+func TestSegment_BadFirstPoint(t *testing.T) {
+	points := []track.Point{point(46, 0)}
+	for i := 1; i < 30; i++ {
+		points = append(points, point(45+float64(i)*0.00005, i))
+	}
+	kept, stats := Segment(Options{MaxSpeed: 50}, points)
+	assert.Equal(t, maxJumpRun, stats.Jumps)
+	assert.Equal(t, len(points)-maxJumpRun, len(kept))
+}
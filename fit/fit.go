@@ -0,0 +1,370 @@
+package fit
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/tkrajina/gpxgo/gpx"
+)
+
+// A decoder for the parts of Garmin's FIT activity files we draw: the position,
+// time, altitude and sensor readings of each record message, split into
+// segments where the timer was stopped.  A FIT file is a header, then a stream
+// of definition messages that describe the layout of a local message type, and
+// data messages laid out by the last definition of their local type, then a
+// CRC.  Everything else in the file is skipped over.
+
+// Magic is the data type signature at bytes 8-11 of every FIT file
+const Magic = ".FIT"
+
+// fitEpoch is the zero of FIT timestamps, 1989-12-31T00:00:00Z
+var fitEpoch = time.Date(1989, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+// semicircles is the size of a degree of latitude or longitude in FIT position units
+const semicircles = (1 << 31) / 180.0
+
+// global message numbers
+const (
+	mesgRecord = 20
+	mesgEvent  = 21
+)
+
+// record message field numbers
+const (
+	fieldPositionLat      = 0
+	fieldPositionLong     = 1
+	fieldAltitude         = 2
+	fieldHeartRate        = 3
+	fieldCadence          = 4
+	fieldPower            = 7
+	fieldEnhancedAltitude = 78
+	fieldTimestamp        = 253
+)
+
+// event message field numbers and values
+const (
+	fieldEvent       = 0
+	fieldEventType   = 1
+	eventTimer       = 0
+	eventTypeStop    = 1
+	eventTypeStopAll = 4
+)
+
+// Record is a single point of an activity
+type Record struct {
+	Latitude  float64
+	Longitude float64
+	Altitude  gpx.NullableFloat64
+	Timestamp time.Time
+
+	Cadence   gpx.NullableFloat64
+	HeartRate gpx.NullableFloat64
+	Power     gpx.NullableFloat64
+}
+
+// Activity is every record with a position in a FIT file, split into segments
+// where the timer was stopped
+type Activity struct {
+	Segments [][]Record
+}
+
+// IsFIT is whether data starts with a FIT file header
+func IsFIT(data []byte) bool {
+	return len(data) >= 12 && (data[0] == 12 || data[0] == 14) && string(data[8:12]) == Magic
+}
+
+type fieldDef struct {
+	num      byte
+	size     int
+	baseType byte
+}
+
+type messageDef struct {
+	global   uint16
+	order    binary.ByteOrder
+	fields   []fieldDef
+	devBytes int
+}
+
+type decoder struct {
+	data      []byte
+	pos       int
+	defs      [16]*messageDef
+	timestamp uint32
+	activity  *Activity
+	segment   []Record
+}
+
+// Decode reads the records of a FIT file, including chained FIT files
+func Decode(data []byte) (*Activity, error) {
+	d := &decoder{data: data, activity: &Activity{}}
+	for d.pos < len(d.data) {
+		if err := d.file(); err != nil {
+			return nil, err
+		}
+	}
+	d.endSegment()
+	return d.activity, nil
+}
+
+func (d *decoder) file() error {
+	header := d.data[d.pos:]
+	if !IsFIT(header) {
+		return errors.New("not a FIT file")
+	}
+	headerSize := int(header[0])
+	if len(header) < headerSize {
+		return errors.New("truncated FIT header")
+	}
+	dataSize := int(binary.LittleEndian.Uint32(header[4:8]))
+	end := d.pos + headerSize + dataSize
+	if end+2 > len(d.data) {
+		return errors.New("truncated FIT file")
+	}
+	if crc := binary.LittleEndian.Uint16(d.data[end:]); crc != CRC(d.data[d.pos:end]) {
+		return errors.New("FIT file CRC mismatch")
+	}
+	d.pos += headerSize
+	d.defs = [16]*messageDef{}
+	for d.pos < end {
+		if err := d.message(end); err != nil {
+			return err
+		}
+	}
+	d.pos = end + 2
+	return nil
+}
+
+func (d *decoder) take(n, end int) ([]byte, error) {
+	if d.pos+n > end {
+		return nil, errors.New("truncated FIT message")
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *decoder) message(end int) error {
+	b, err := d.take(1, end)
+	if err != nil {
+		return err
+	}
+	header := b[0]
+	if header&0x80 != 0 {
+		// compressed timestamp header: a 5 bit offset from the last timestamp
+		offset := uint32(header & 0x1F)
+		ts := d.timestamp&^0x1F | offset
+		if offset < d.timestamp&0x1F {
+			ts += 0x20
+		}
+		d.timestamp = ts
+		return d.dataMessage(int(header>>5)&0x3, end, true)
+	}
+	local := int(header & 0x0F)
+	if header&0x40 != 0 {
+		return d.definition(local, header&0x20 != 0, end)
+	}
+	return d.dataMessage(local, end, false)
+}
+
+func (d *decoder) definition(local int, devData bool, end int) error {
+	b, err := d.take(5, end)
+	if err != nil {
+		return err
+	}
+	def := &messageDef{order: binary.LittleEndian}
+	if b[1] == 1 {
+		def.order = binary.BigEndian
+	}
+	def.global = def.order.Uint16(b[2:4])
+	fields, err := d.take(int(b[4])*3, end)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(fields); i += 3 {
+		def.fields = append(def.fields, fieldDef{num: fields[i], size: int(fields[i+1]), baseType: fields[i+2]})
+	}
+	if devData {
+		n, err := d.take(1, end)
+		if err != nil {
+			return err
+		}
+		devFields, err := d.take(int(n[0])*3, end)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < len(devFields); i += 3 {
+			def.devBytes += int(devFields[i+1])
+		}
+	}
+	d.defs[local] = def
+	return nil
+}
+
+// dataMessage reads a data message, compressed is whether its timestamp came
+// from the record header
+func (d *decoder) dataMessage(local int, end int, compressed bool) error {
+	def := d.defs[local]
+	if def == nil {
+		return fmt.Errorf("FIT data message for undefined local type %d", local)
+	}
+	values := map[byte]float64{}
+	for _, f := range def.fields {
+		b, err := d.take(f.size, end)
+		if err != nil {
+			return err
+		}
+		if v, ok := value(b, f.baseType, def.order); ok {
+			values[f.num] = v
+		}
+	}
+	if _, err := d.take(def.devBytes, end); err != nil {
+		return err
+	}
+	if ts, ok := values[fieldTimestamp]; ok && !compressed {
+		d.timestamp = uint32(ts)
+	}
+
+	switch def.global {
+	case mesgRecord:
+		d.record(values)
+	case mesgEvent:
+		event, okEvent := values[fieldEvent]
+		eventType, okType := values[fieldEventType]
+		if okEvent && okType && event == eventTimer && (eventType == eventTypeStop || eventType == eventTypeStopAll) {
+			d.endSegment()
+		}
+	}
+	return nil
+}
+
+func (d *decoder) record(values map[byte]float64) {
+	lat, okLat := values[fieldPositionLat]
+	lon, okLon := values[fieldPositionLong]
+	if !okLat || !okLon {
+		// indoor or before the GPS got a fix, nothing to draw
+		return
+	}
+	r := Record{
+		Latitude:  lat / semicircles,
+		Longitude: lon / semicircles,
+	}
+	if d.timestamp != 0 {
+		r.Timestamp = fitEpoch.Add(time.Duration(d.timestamp) * time.Second)
+	}
+	if alt, ok := values[fieldEnhancedAltitude]; ok {
+		r.Altitude.SetValue(alt/5 - 500)
+	} else if alt, ok := values[fieldAltitude]; ok {
+		r.Altitude.SetValue(alt/5 - 500)
+	}
+	if hr, ok := values[fieldHeartRate]; ok {
+		r.HeartRate.SetValue(hr)
+	}
+	if cad, ok := values[fieldCadence]; ok {
+		r.Cadence.SetValue(cad)
+	}
+	if power, ok := values[fieldPower]; ok {
+		r.Power.SetValue(power)
+	}
+	d.segment = append(d.segment, r)
+}
+
+func (d *decoder) endSegment() {
+	if len(d.segment) > 0 {
+		d.activity.Segments = append(d.activity.Segments, d.segment)
+		d.segment = nil
+	}
+}
+
+// value decodes a single numeric field, returning false for the invalid value
+// of its type and for strings, arrays and other fields we don't read
+func value(b []byte, baseType byte, order binary.ByteOrder) (float64, bool) {
+	switch baseType & 0x1F {
+	case 0, 2: // enum, uint8
+		if len(b) != 1 {
+			return 0, false
+		}
+		return float64(b[0]), b[0] != 0xFF
+	case 10: // uint8z
+		if len(b) != 1 {
+			return 0, false
+		}
+		return float64(b[0]), b[0] != 0
+	case 1: // sint8
+		if len(b) != 1 {
+			return 0, false
+		}
+		return float64(int8(b[0])), b[0] != 0x7F
+	case 3: // sint16
+		if len(b) != 2 {
+			return 0, false
+		}
+		v := order.Uint16(b)
+		return float64(int16(v)), v != 0x7FFF
+	case 4: // uint16
+		if len(b) != 2 {
+			return 0, false
+		}
+		v := order.Uint16(b)
+		return float64(v), v != 0xFFFF
+	case 11: // uint16z
+		if len(b) != 2 {
+			return 0, false
+		}
+		v := order.Uint16(b)
+		return float64(v), v != 0
+	case 5: // sint32
+		if len(b) != 4 {
+			return 0, false
+		}
+		v := order.Uint32(b)
+		return float64(int32(v)), v != 0x7FFFFFFF
+	case 6: // uint32
+		if len(b) != 4 {
+			return 0, false
+		}
+		v := order.Uint32(b)
+		return float64(v), v != 0xFFFFFFFF
+	case 12: // uint32z
+		if len(b) != 4 {
+			return 0, false
+		}
+		v := order.Uint32(b)
+		return float64(v), v != 0
+	case 8: // float32
+		if len(b) != 4 {
+			return 0, false
+		}
+		v := order.Uint32(b)
+		return float64(math.Float32frombits(v)), v != 0xFFFFFFFF
+	case 9: // float64
+		if len(b) != 8 {
+			return 0, false
+		}
+		v := order.Uint64(b)
+		return math.Float64frombits(v), v != 0xFFFFFFFFFFFFFFFF
+	}
+	return 0, false
+}
+
+var crcTable = [16]uint16{
+	0x0000, 0xCC01, 0xD801, 0x1400, 0xF001, 0x3C00, 0x2800, 0xE401,
+	0xA001, 0x6C00, 0x7800, 0xB401, 0x5000, 0x9C01, 0x8801, 0x4400,
+}
+
+// CRC is the FIT flavor of CRC-16 over data
+func CRC(data []byte) uint16 {
+	crc := uint16(0)
+	for _, b := range data {
+		tmp := crcTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ crcTable[b&0xF]
+		tmp = crcTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ crcTable[(b>>4)&0xF]
+	}
+	return crc
+}
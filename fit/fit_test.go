@@ -0,0 +1,141 @@
+package fit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fitFile wraps messages in a FIT header and CRC
+func fitFile(messages []byte) []byte {
+	header := []byte{14, 0x20, 0, 0, 0, 0, 0, 0, '.', 'F', 'I', 'T', 0, 0}
+	binary.LittleEndian.PutUint16(header[2:], 2132)
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(messages)))
+	binary.LittleEndian.PutUint16(header[12:], CRC(header[:12]))
+	data := append(header, messages...)
+	crc := make([]byte, 2)
+	binary.LittleEndian.PutUint16(crc, CRC(data))
+	return append(data, crc...)
+}
+
+func semis(deg float64) int32 {
+	return int32(deg * semicircles)
+}
+
+var recordDef = []byte{
+	0x40, 0, 0, mesgRecord, 0, 7,
+	fieldTimestamp, 4, 0x86,
+	fieldPositionLat, 4, 0x85,
+	fieldPositionLong, 4, 0x85,
+	fieldAltitude, 2, 0x84,
+	fieldHeartRate, 1, 0x02,
+	fieldCadence, 1, 0x02,
+	fieldPower, 2, 0x84,
+}
+
+var eventDef = []byte{
+	0x41, 0, 0, mesgEvent, 0, 3,
+	fieldTimestamp, 4, 0x86,
+	fieldEvent, 1, 0x00,
+	fieldEventType, 1, 0x00,
+}
+
+func record(header byte, ts uint32, lat, lon float64, alt float64, hr, cad byte, power uint16) []byte {
+	b := &bytes.Buffer{}
+	b.WriteByte(header)
+	binary.Write(b, binary.LittleEndian, ts)
+	binary.Write(b, binary.LittleEndian, semis(lat))
+	binary.Write(b, binary.LittleEndian, semis(lon))
+	binary.Write(b, binary.LittleEndian, uint16((alt+500)*5))
+	b.WriteByte(hr)
+	b.WriteByte(cad)
+	binary.Write(b, binary.LittleEndian, power)
+	return b.Bytes()
+}
+
+func event(ts uint32, eventType byte) []byte {
+	b := &bytes.Buffer{}
+	b.WriteByte(0x01)
+	binary.Write(b, binary.LittleEndian, ts)
+	b.WriteByte(eventTimer)
+	b.WriteByte(eventType)
+	return b.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	start := uint32(1000000000)
+	messages := []byte{}
+	messages = append(messages, recordDef...)
+	messages = append(messages, eventDef...)
+	messages = append(messages, record(0x00, start, 45, -93, 250, 120, 85, 200)...)
+	messages = append(messages, record(0x00, start+1, 45.0001, -93, 251, 0xFF, 0xFF, 0xFFFF)...)
+	messages = append(messages, event(start+2, eventTypeStop)...)
+	messages = append(messages, record(0x00, start+60, 45.0002, -93, 252, 130, 90, 250)...)
+
+	act, err := Decode(fitFile(messages))
+	assert.NoError(t, err)
+	assert.Len(t, act.Segments, 2)
+	assert.Len(t, act.Segments[0], 2)
+	assert.Len(t, act.Segments[1], 1)
+
+	r := act.Segments[0][0]
+	assert.InDelta(t, 45, r.Latitude, 1e-6)
+	assert.InDelta(t, -93, r.Longitude, 1e-6)
+	assert.InDelta(t, 250, r.Altitude.Value(), 0.2)
+	assert.Equal(t, fitEpoch.Add(time.Duration(start)*time.Second), r.Timestamp)
+	assert.Equal(t, 120.0, r.HeartRate.Value())
+	assert.Equal(t, 85.0, r.Cadence.Value())
+	assert.Equal(t, 200.0, r.Power.Value())
+
+	// invalid values are null
+	r = act.Segments[0][1]
+	assert.True(t, r.HeartRate.Null())
+	assert.True(t, r.Cadence.Null())
+	assert.True(t, r.Power.Null())
+	assert.Equal(t, 130.0, act.Segments[1][0].HeartRate.Value())
+}
+
+func TestDecodeCompressedTimestamp(t *testing.T) {
+	start := uint32(1000000030) // low 5 bits are 30, so the offsets roll over
+	messages := append([]byte{}, recordDef...)
+	messages = append(messages, record(0x00, start, 45, -93, 250, 120, 85, 200)...)
+	// compressed headers carry no timestamp field, so use a definition without one
+	messages = append(messages, 0x42, 0, 0, mesgRecord, 0, 2, fieldPositionLat, 4, 0x85, fieldPositionLong, 4, 0x85)
+	for _, offset := range []byte{31, 1} {
+		b := &bytes.Buffer{}
+		b.WriteByte(0x80 | 2<<5 | offset)
+		binary.Write(b, binary.LittleEndian, semis(45))
+		binary.Write(b, binary.LittleEndian, semis(-93))
+		messages = append(messages, b.Bytes()...)
+	}
+
+	act, err := Decode(fitFile(messages))
+	assert.NoError(t, err)
+	assert.Len(t, act.Segments, 1)
+	assert.Len(t, act.Segments[0], 3)
+	base := fitEpoch.Add(time.Duration(start) * time.Second)
+	assert.Equal(t, base.Add(time.Second), act.Segments[0][1].Timestamp)
+	assert.Equal(t, base.Add(3*time.Second), act.Segments[0][2].Timestamp)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	good := fitFile(append(append([]byte{}, recordDef...), record(0x00, 1, 45, -93, 250, 120, 85, 200)...))
+	assert.True(t, IsFIT(good))
+	assert.False(t, IsFIT([]byte("<?xml version=\"1.0\"?><gpx></gpx>")))
+
+	bad := append([]byte{}, good...)
+	bad[len(bad)-5] ^= 0xFF
+	_, err := Decode(bad)
+	assert.Error(t, err)
+
+	_, err = Decode(good[:len(good)-4])
+	assert.Error(t, err)
+
+	// chained files
+	act, err := Decode(append(append([]byte{}, good...), good...))
+	assert.NoError(t, err)
+	assert.Len(t, act.Segments[0], 2)
+}
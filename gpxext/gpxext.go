@@ -0,0 +1,113 @@
+package gpxext
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/tkrajina/gpxgo/gpx"
+)
+
+// gpxgo doesn't expose the <extensions> of track points, so this reads them
+// out of the raw document.  Garmin and Apple export sensor data like
+//
+//	<trkpt lat="45.0" lon="45.0">
+//	  <extensions>
+//	    <gpxtpx:TrackPointExtension>
+//	      <gpxtpx:hr>142</gpxtpx:hr>
+//	      <gpxtpx:cad>88</gpxtpx:cad>
+//	    </gpxtpx:TrackPointExtension>
+//	    <power>231</power>
+//	  </extensions>
+//	</trkpt>
+//
+// Elements are matched by local name so the namespace prefix doesn't matter.
+
+// Values are the sensor readings found in the extensions of a single point
+type Values struct {
+	Cadence   gpx.NullableFloat64
+	HeartRate gpx.NullableFloat64
+	Power     gpx.NullableFloat64
+}
+
+// Track holds the extension values of every point in a track, indexed the same
+// as gpx.GPXTrack.Segments[seg].Points[pt]
+type Track [][]Values
+
+// setters maps extension element local names to the Values field they fill
+var setters = map[string]func(v *Values, f float64){
+	"hr":           func(v *Values, f float64) { v.HeartRate.SetValue(f) },
+	"cad":          func(v *Values, f float64) { v.Cadence.SetValue(f) },
+	"cadence":      func(v *Values, f float64) { v.Cadence.SetValue(f) },
+	"power":        func(v *Values, f float64) { v.Power.SetValue(f) },
+	"PowerInWatts": func(v *Values, f float64) { v.Power.SetValue(f) },
+	"watts":        func(v *Values, f float64) { v.Power.SetValue(f) },
+}
+
+// Parse reads the extensions of every track point in a GPX document.  The result
+// is indexed the same as gpx.GPX.Tracks, so it lines up with gpx.ParseBytes
+func Parse(data []byte) ([]Track, error) {
+	tracks := []Track{}
+	d := xml.NewDecoder(bytes.NewReader(data))
+	inPoint := false
+	inExtensions := false
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return tracks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch {
+			case t.Name.Local == "trk":
+				tracks = append(tracks, Track{})
+			case t.Name.Local == "trkseg" && len(tracks) > 0:
+				tracks[len(tracks)-1] = append(tracks[len(tracks)-1], []Values{})
+			case t.Name.Local == "trkpt" && len(tracks) > 0 && len(tracks[len(tracks)-1]) > 0:
+				trk := tracks[len(tracks)-1]
+				trk[len(trk)-1] = append(trk[len(trk)-1], Values{})
+				inPoint = true
+			case t.Name.Local == "extensions" && inPoint:
+				inExtensions = true
+			case inExtensions:
+				set, ok := setters[t.Name.Local]
+				if !ok {
+					continue
+				}
+				var s string
+				if err := d.DecodeElement(&s, &t); err != nil {
+					return nil, err
+				}
+				f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+				if err != nil {
+					// ignore junk values, the point just won't have this reading
+					continue
+				}
+				trk := tracks[len(tracks)-1]
+				seg := trk[len(trk)-1]
+				set(&seg[len(seg)-1], f)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "trkpt":
+				inPoint = false
+				inExtensions = false
+			case "extensions":
+				inExtensions = false
+			}
+		}
+	}
+}
+
+// At returns the extension values for a point, or empty Values if there are none
+func At(tracks []Track, trk, seg, pt int) Values {
+	if trk >= len(tracks) || seg >= len(tracks[trk]) || pt >= len(tracks[trk][seg]) {
+		return Values{}
+	}
+	return tracks[trk][seg][pt]
+}
@@ -0,0 +1,65 @@
+package gpxext
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tkrajina/gpxgo/gpx"
+)
+
+const testGPX = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1"
+  xmlns:gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v1">
+  <trk>
+    <trkseg>
+      <trkpt lat="45.0" lon="45.0">
+        <extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>120</gpxtpx:hr><gpxtpx:cad>85</gpxtpx:cad></gpxtpx:TrackPointExtension><power>250</power></extensions>
+      </trkpt>
+      <trkpt lat="45.001" lon="45.0"></trkpt>
+    </trkseg>
+    <trkseg>
+      <trkpt lat="45.002" lon="45.0">
+        <extensions><gpxtpx:TrackPointExtension><gpxtpx:hr> 151 </gpxtpx:hr></gpxtpx:TrackPointExtension></extensions>
+      </trkpt>
+    </trkseg>
+  </trk>
+  <trk>
+    <trkseg>
+      <trkpt lat="46.0" lon="45.0">
+        <extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>junk</gpxtpx:hr></gpxtpx:TrackPointExtension></extensions>
+      </trkpt>
+    </trkseg>
+  </trk>
+</gpx>`
+
+func TestParse(t *testing.T) {
+	tracks, err := Parse([]byte(testGPX))
+	assert.NoError(t, err)
+
+	// must line up with what gpxgo parses
+	gpxdata, err := gpx.ParseBytes([]byte(testGPX))
+	assert.NoError(t, err)
+	assert.Equal(t, len(gpxdata.Tracks), len(tracks))
+	for i, trk := range gpxdata.Tracks {
+		assert.Equal(t, len(trk.Segments), len(tracks[i]))
+		for j, seg := range trk.Segments {
+			assert.Equal(t, len(seg.Points), len(tracks[i][j]))
+		}
+	}
+
+	hr := At(tracks, 0, 0, 0).HeartRate
+	assert.True(t, hr.NotNull())
+	assert.Equal(t, 120.0, hr.Value())
+	cad := At(tracks, 0, 0, 0).Cadence
+	assert.Equal(t, 85.0, cad.Value())
+	pwr := At(tracks, 0, 0, 0).Power
+	assert.Equal(t, 250.0, pwr.Value())
+	hr = At(tracks, 0, 0, 1).HeartRate
+	assert.True(t, hr.Null())
+	hr = At(tracks, 0, 1, 0).HeartRate
+	assert.Equal(t, 151.0, hr.Value())
+	hr = At(tracks, 1, 0, 0).HeartRate
+	assert.True(t, hr.Null())
+	hr = At(tracks, 5, 0, 0).HeartRate
+	assert.True(t, hr.Null())
+}
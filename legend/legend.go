@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"image"
 	"image/color"
+	"math"
 
 	"github.com/fogleman/gg"
+	"github.com/meekmichael/gpxrainbow/canvas"
 	"github.com/meekmichael/gpxrainbow/pattern"
 )
 
@@ -21,45 +23,94 @@ var textColor = color.RGBA{248, 248, 248, 255}
 
 // Options configures the legend
 type Options struct {
+	// ClippedMax and ClippedMin mark that values beyond MaxVal or MinVal are
+	// drawn in the end color, the end labels get a >= or <=
+	ClippedMax    bool
+	ClippedMin    bool
 	FormatString  string
 	GradientTable pattern.GradientTable
-	MaxVal        float64
-	MinVal        float64
-	Steps         int
-	Title         string
+	// LabelFormatter formats the tick labels, when set it is used instead of FormatString
+	LabelFormatter func(float64) string
+	MaxVal         float64
+	MinVal         float64
+	Steps          int
+	Title          string
+}
+
+// Label formats a value like the legend's tick labels
+func (opts Options) Label(v float64) string {
+	if opts.LabelFormatter != nil {
+		return opts.LabelFormatter(v)
+	}
+	return fmt.Sprintf(opts.FormatString, v)
 }
 
 // Render puts the legend on the image and returns the be-legened image
 func Render(opts Options, img image.Image) (image.Image, error) {
 	gc := gg.NewContextForImage(img)
-	if gc.Width() < (2*outerXPt) || gc.Height() < (3*outerYHeight) {
+	Draw(opts, canvas.NewGG(gc))
+	return gc.Image(), nil
+}
+
+// Draw draws the legend in the bottom right corner of a canvas
+func Draw(opts Options, c canvas.Canvas) {
+	width, height := float64(c.Width()), float64(c.Height())
+	if width < (2*outerXPt) || height < (3*outerYHeight) {
 		// image too small for legend
-		return img, nil
+		return
 	}
 	if opts.Steps < 2 {
-		return img, nil
+		return
 	}
-	gc.SetColor(outerColor)
-	gc.DrawRectangle(float64(gc.Width())-outerXPt, float64(gc.Height())-outerYPt, outerXPt, outerYHeight)
-	gc.Fill()
+	gt := opts.GradientTable
+	if len(gt) == 0 {
+		gt = pattern.GetGradientTable()
+	}
+	c.Rect(width-outerXPt, height-outerYPt, outerXPt, outerYHeight, outerColor)
 
 	for i := 0; i < opts.Steps; i++ {
 		step := float64(i) * float64(rainbowWidth/opts.Steps)
-		gc.DrawRectangle(float64(gc.Width())-rainbowWidth-20+step, float64(gc.Height())-rainbowYTop, rainbowWidth-step, rainbowHeight)
-		gc.SetColor(pattern.GetGradientTable().GetInterpolatedColorFor(float64(i) / float64(opts.Steps)))
-		gc.Fill()
+		c.Rect(width-rainbowWidth-20+step, height-rainbowYTop, rainbowWidth-step, rainbowHeight, gt.GetInterpolatedColorFor(float64(i)/float64(opts.Steps)))
+	}
+	c.Text(opts.Title, width-(rainbowWidth/2)-20, height-rainbowYTop+rainbowHeight+10, 0.5, 0.5, textColor)
+	for _, tick := range Ticks(opts) {
+		x := width - rainbowWidth - 20 + (rainbowWidth * tick.Pos)
+		// keep long labels at the warm end from running off the image
+		w, _ := c.MeasureString(tick.Label)
+		x = math.Min(x, width-w/2-2)
+		c.Text(tick.Label, x, height-outerYHeight+5, 0.5, 0.5, textColor)
 	}
-	gc.SetColor(textColor)
-	gc.DrawStringAnchored(opts.Title, float64(gc.Width())-(rainbowWidth/2)-20, float64(gc.Height()-rainbowYTop+rainbowHeight+10), 0.5, 0.5)
+}
+
+// Tick is a label along the color scale, at Pos from 0 at the cool end to 1 at
+// the warm end
+type Tick struct {
+	Pos   float64
+	Label string
+}
+
+// Ticks are the labels along the color scale
+func Ticks(opts Options) []Tick {
 	lSteps := 4.0
 	if float64(opts.Steps) < lSteps {
 		lSteps = float64(opts.Steps)
 	}
-	lStep := 0.0
-	for i := opts.MinVal; i <= opts.MaxVal; i += ((opts.MaxVal - opts.MinVal) / lSteps) {
-		gc.DrawStringAnchored(fmt.Sprintf(opts.FormatString, i), float64(gc.Width())-rainbowWidth-20+(rainbowWidth*lStep), float64(gc.Height())-outerYHeight+5, 0.5, 0.5)
-		lStep += (1.0 / lSteps)
+	// the scale can run backwards, like pace where the slow end is cool
+	minSym, maxSym := "<=", ">="
+	if opts.MinVal > opts.MaxVal {
+		minSym, maxSym = maxSym, minSym
 	}
-
-	return gc.Image(), nil
+	ticks := []Tick{}
+	for i := 0.0; i <= lSteps; i++ {
+		lStep := i / lSteps
+		val := opts.MinVal + (opts.MaxVal-opts.MinVal)*lStep
+		label := opts.Label(val)
+		if i == 0 && opts.ClippedMin {
+			label = minSym + label
+		} else if i == lSteps && opts.ClippedMax {
+			label = maxSym + label
+		}
+		ticks = append(ticks, Tick{Pos: lStep, Label: label})
+	}
+	return ticks
 }
@@ -13,6 +13,7 @@ import (
 
 func main() {
 	logger := log.New(os.Stdout, "gpxrainbow: ", log.Lshortfile)
+	defaults := config.DefaultOptions()
 	app := &cli.App{
 		Name:     "gpxrainbow",
 		HelpName: "",
@@ -24,31 +25,31 @@ func main() {
 				Name:    "width",
 				Aliases: []string{"x"},
 				Usage:   "width of output image",
-				Value:   2048,
+				Value:   defaults.Width,
 			},
 			&cli.IntFlag{
 				Name:    "height",
 				Aliases: []string{"y"},
 				Usage:   "height of output image",
-				Value:   1536,
+				Value:   defaults.Height,
 			},
 			&cli.IntFlag{
 				Name:    "linewidth",
 				Aliases: []string{"l"},
 				Usage:   "line width (in pixels)",
-				Value:   3,
+				Value:   defaults.LineWidth,
 			},
 			&cli.StringFlag{
 				Name:    "mode",
 				Aliases: []string{"m"},
-				Usage:   "mode - [proximity|speed|elevation|date]",
-				Value:   config.MODE_PROXIMITY,
+				Usage:   "mode - [proximity|overlap|input|speed|elevation|heartrate|cadence|power|date|grade|timeofday|pace]",
+				Value:   defaults.Mode,
 			},
 			&cli.StringFlag{
 				Name:    "tileprovider",
 				Aliases: []string{"tp"},
-				Usage:   "OpenStreetMap tile provider, use --list-tileprovider to get a list",
-				Value:   "carto-light",
+				Usage:   "OpenStreetMap tile provider, use --list-tileprovider to get a list, or \"none\" for no basemap",
+				Value:   defaults.TileProvider,
 			},
 			&cli.BoolFlag{
 				Name:  "list-tileprovider",
@@ -58,20 +59,138 @@ func main() {
 			&cli.StringFlag{
 				Name:    "outputfile",
 				Aliases: []string{"o"},
-				Usage:   "file to write the map to (must be a png)",
-				Value:   "output.png",
+				Usage:   "file to write the map to (.png, .jpg, .svg, .pdf or .html), data (.geojson or .kml), a directory of map tiles (with --format tiles), or an animation (.gif, .apng or frames like \"frames/%04d.png\")",
+				Value:   defaults.OutputFile,
+			},
+			&cli.StringFlag{
+				Name:  "format",
+				Usage: "output format - [png|jpg|svg|pdf|gif|apng|html|geojson|kml|tiles], instead of going by the output file's extension",
 			},
 			&cli.IntFlag{
 				Name:    "proximity_distance",
 				Aliases: []string{"d"},
 				Usage:   "distance in meters (approx) to color path the same in proximity mode",
-				Value:   10,
+				Value:   defaults.ProximityDistance,
+			},
+			&cli.IntFlag{
+				Name:  "ftp",
+				Usage: "functional threshold power in watts, shows power mode as a percentage of FTP (0 = off)",
+				Value: defaults.FTP,
+			},
+			&cli.IntFlag{
+				Name:  "grade_window",
+				Usage: "distance in meters to smooth elevation over when computing grade in grade mode",
+				Value: defaults.GradeWindow,
+			},
+			&cli.StringFlag{
+				Name:    "scale_clip",
+				Aliases: []string{"scale-clip"},
+				Usage:   "clip the color scale at these low,high percentiles of the values so outliers don't squash it (e.g. \"2,98\")",
+			},
+			&cli.StringFlag{
+				Name:  "min",
+				Usage: "fix the low end of the color scale, in legend units (m:ss for pace)",
+			},
+			&cli.StringFlag{
+				Name:  "max",
+				Usage: "fix the high end of the color scale, in legend units (m:ss for pace)",
+			},
+			&cli.StringFlag{
+				Name:  "slowest_pace",
+				Usage: "slowest pace shown in pace mode (m:ss per km, or per mile for us units), slower is clamped so stops don't blow the scale",
+				Value: defaults.SlowestPace,
+			},
+			&cli.Float64Flag{
+				Name:  "filter_speed",
+				Usage: "drop GPS points implying a speed over this many kph (mph for us units), 0 = off, try 150",
+				Value: defaults.FilterSpeed,
+			},
+			&cli.Float64Flag{
+				Name:  "filter_accel",
+				Usage: "drop GPS points implying an acceleration over this many meters/second^2, 0 = off, try 20",
+				Value: defaults.FilterAccel,
+			},
+			&cli.Float64Flag{
+				Name:  "filter_distance",
+				Usage: "drop GPS points less than this many meters from the previous point, 0 = off, try 0.5",
+				Value: defaults.FilterDistance,
+			},
+			&cli.BoolFlag{
+				Name:  "filter_duplicates",
+				Usage: "drop GPS points with the same timestamp as the previous point",
+			},
+			&cli.StringFlag{
+				Name:  "routes",
+				Usage: "how to draw GPX routes - \"planned\" (dashed), \"track\" (colored like tracks) or \"none\"",
+				Value: defaults.Routes,
+			},
+			&cli.BoolFlag{
+				Name:    "no_basemap",
+				Aliases: []string{"no-basemap"},
+				Usage:   "draw only the paths, waypoints and legend on a transparent image, without fetching any tiles (same as --tileprovider none)",
+			},
+			&cli.BoolFlag{
+				Name:  "no_waypoints",
+				Usage: "don't draw GPX waypoints",
+			},
+			&cli.StringFlag{
+				Name:  "animation",
+				Usage: "how animations draw the tracks - \"progressive\" (in the order they were recorded) or \"race\" (all starting at once)",
+				Value: defaults.Animation,
+			},
+			&cli.Float64Flag{
+				Name:  "duration",
+				Usage: "length of an animation in seconds",
+				Value: defaults.Duration,
+			},
+			&cli.IntFlag{
+				Name:  "fps",
+				Usage: "frames per second of an animation",
+				Value: defaults.FPS,
+			},
+			&cli.Float64Flag{
+				Name:  "fade",
+				Usage: "seconds for lines in an animation to fade out after they're drawn, 0 = off",
+				Value: defaults.Fade,
+			},
+			&cli.BoolFlag{
+				Name:  "world_file",
+				Usage: "write a world file (.pgw or .jgw) and .prj beside a .png or .jpg, to place it in GIS programs like QGIS",
+			},
+			&cli.StringFlag{
+				Name:  "zoom_range",
+				Usage: "zoom levels of a tile pyramid (--format tiles), like \"10-16\" or just \"14\"",
+				Value: defaults.ZoomRange,
+			},
+			&cli.StringFlag{
+				Name:  "page_size",
+				Usage: "paper size of a PDF - a0 to a5, letter, legal, tabloid or a size like \"300x200mm\" or \"11x17in\", replaces --width and --height",
+				Value: defaults.PageSize,
+			},
+			&cli.BoolFlag{
+				Name:  "landscape",
+				Usage: "turn the PDF page sideways",
+			},
+			&cli.Float64Flag{
+				Name:  "margin",
+				Usage: "margin around the map on a PDF page, in mm",
+				Value: defaults.Margin,
+			},
+			&cli.IntFlag{
+				Name:  "dpi",
+				Usage: "resolution of the basemap on a PDF page, which sets the size of the map in pixels",
+				Value: defaults.DPI,
+			},
+			&cli.StringFlag{
+				Name:  "timezone",
+				Usage: "timezone for timeofday mode, GPX timestamps are UTC (e.g. \"America/Chicago\")",
+				Value: defaults.Timezone,
 			},
 			&cli.StringFlag{
 				Name:    "units",
 				Aliases: []string{"u"},
 				Usage:   "units - \"us\" or \"metric\"",
-				Value:   "metric",
+				Value:   defaults.Units,
 			},
 		},
 		Action: path.Run,
@@ -0,0 +1,93 @@
+package marker
+
+import (
+	"image/color"
+	"math"
+
+	sm "github.com/flopp/go-staticmaps"
+	"github.com/fogleman/gg"
+	"github.com/golang/geo/s2"
+	"github.com/meekmichael/gpxrainbow/canvas"
+)
+
+// implements the map object interface for go-staticmaps for a marker with its
+// name written beside it.  go-staticmaps markers only fit a letter or two inside
+// the pin, waypoint names are usually longer.
+
+// labelGap is the space in pixels between the pin and its label
+const labelGap = 4.0
+
+var pinColor = color.RGBA{0x33, 0x33, 0x33, 0xff}
+var labelColor = color.RGBA{0x00, 0x00, 0x00, 0xff}
+var haloColor = color.NRGBA{0xff, 0xff, 0xff, 0xcc}
+
+// Labeled is a map pin with a text label to its right
+type Labeled struct {
+	*sm.Marker
+	Name string
+}
+
+// NewLabeled builds a labeled pin of the given size (pixels)
+func NewLabeled(pos s2.LatLng, name string, size float64) *Labeled {
+	return &Labeled{
+		Marker: sm.NewMarker(pos, pinColor, size),
+		Name:   name,
+	}
+}
+
+// labelSize measures the label in the default font
+func (m *Labeled) labelSize() (float64, float64) {
+	if m.Name == "" {
+		return 0, 0
+	}
+	return gg.NewContext(1, 1).MeasureString(m.Name)
+}
+
+// ExtraMarginPixels - to help go-staticmap find render bounds, making room for
+// the label too
+func (m *Labeled) ExtraMarginPixels() (float64, float64, float64, float64) {
+	left, top, right, bottom := m.Marker.ExtraMarginPixels()
+	w, h := m.labelSize()
+	if w > 0 {
+		right = math.Max(right, 0.5*m.Size+labelGap+w+1)
+		top = math.Max(top, m.Size+0.5*h+1)
+	}
+	return left, top, right, bottom
+}
+
+// Draw draws the pin, then the label with a halo so it reads on any map
+func (m *Labeled) Draw(gc *gg.Context, trans *sm.Transformer) {
+	m.Marker.Draw(gc, trans)
+	x, y := trans.LatLngToXY(m.Position)
+	m.drawLabel(canvas.NewGG(gc), x, y)
+}
+
+// DrawCanvas draws the pin and label on any canvas, the same shape as
+// go-staticmaps draws its markers
+func (m *Labeled) DrawCanvas(c canvas.Canvas, project canvas.Projection) {
+	x, y := project(m.Position)
+	radius := 0.5 * m.Size
+	xy := []float64{}
+	for a := 150.0; a <= 390; a += 10 {
+		rad := a * math.Pi / 180
+		xy = append(xy, x+radius*math.Cos(rad), y-m.Size+radius*math.Sin(rad))
+	}
+	xy = append(xy, x, y)
+	c.Polygon(xy, m.Color, color.Black, 1)
+	m.drawLabel(c, x, y)
+}
+
+// drawLabel writes the name beside a pin at x, y
+func (m *Labeled) drawLabel(c canvas.Canvas, x, y float64) {
+	if m.Name == "" {
+		return
+	}
+	x += 0.5*m.Size + labelGap
+	y -= m.Size
+	for dy := -1.0; dy <= 1; dy++ {
+		for dx := -1.0; dx <= 1; dx++ {
+			c.Text(m.Name, x+dx, y+dy, 0, 0.5, haloColor)
+		}
+	}
+	c.Text(m.Name, x, y, 0, 0.5, labelColor)
+}
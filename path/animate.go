@@ -0,0 +1,340 @@
+package path
+
+import (
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	sm "github.com/flopp/go-staticmaps"
+	"github.com/fogleman/gg"
+	"github.com/golang/geo/s1"
+	"github.com/golang/geo/s2"
+	"github.com/meekmichael/gpxrainbow/apng"
+	"github.com/meekmichael/gpxrainbow/canvas"
+	"github.com/meekmichael/gpxrainbow/colorpath"
+	"github.com/meekmichael/gpxrainbow/config"
+	"github.com/meekmichael/gpxrainbow/legend"
+	"github.com/meekmichael/gpxrainbow/track"
+)
+
+// holdLast is how much longer the last frame of an animation shows, so the
+// finished map can be seen before it loops
+const holdLast = 2 * time.Second
+
+// fadeSteps is how many levels of fading a trail is drawn with
+const fadeSteps = 10
+
+// RenderFrames reads every source and draws an animation of the tracks being
+// drawn, calling frame with each frame in turn.  The basemap, planned routes,
+// waypoints and legend are rendered once and are the same in every frame.
+func (r *Renderer) RenderFrames(sources []track.Source, frame func(img *image.RGBA) error) error {
+	sc, err := r.scene(sources)
+	if err != nil {
+		return err
+	}
+	v, err := r.fixView(sc)
+	if err != nil {
+		return err
+	}
+	tracks := map[sm.MapObject]bool{}
+	for _, cp := range sc.tracks {
+		tracks[cp] = true
+	}
+	sc.ctx.ClearObjects()
+	still := []sm.MapObject{}
+	for _, obj := range sc.objects {
+		if !tracks[obj] {
+			sc.ctx.AddObject(obj)
+			still = append(still, obj)
+		}
+	}
+	base, err := r.renderMap(sc, still)
+	if err != nil {
+		return err
+	}
+
+	paths := animPaths(r.Config.Animation, sc.tracks)
+	frames := r.Config.Frames()
+	fade := r.Config.Fade / r.Config.Duration
+	r.logf("Drawing %d frames\n", frames)
+	for i := 0; i < frames; i++ {
+		clock := 1.0
+		if frames > 1 {
+			clock = float64(i) / float64(frames-1)
+		}
+		img := image.NewRGBA(image.Rect(0, 0, base.Bounds().Dx(), base.Bounds().Dy()))
+		draw.Draw(img, img.Bounds(), base, base.Bounds().Min, draw.Src)
+		c := canvas.NewGG(gg.NewContextForRGBA(img))
+		for _, ap := range paths {
+			for _, cp := range ap.at(clock, fade) {
+				cp.DrawCanvas(c, v.project)
+			}
+		}
+		if sc.legend != nil {
+			legend.Draw(*sc.legend, c)
+		}
+		if err := frame(img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RenderGIF reads every source and writes an animated GIF of the tracks being
+// drawn.  Frames only store what changed from the one before.
+func (r *Renderer) RenderGIF(sources []track.Source, w io.Writer) error {
+	anim := &gif.GIF{}
+	delay := int(math.Round(100 / float64(r.Config.FPS)))
+	var prev *image.RGBA
+	err := r.RenderFrames(sources, func(img *image.RGBA) error {
+		rect := img.Bounds()
+		if prev != nil {
+			rect = changed(prev, img)
+		}
+		p := image.NewPaletted(rect, palette.Plan9)
+		draw.FloydSteinberg.Draw(p, rect, img, rect.Min)
+		anim.Image = append(anim.Image, p)
+		anim.Delay = append(anim.Delay, delay)
+		anim.Disposal = append(anim.Disposal, gif.DisposalNone)
+		prev = img
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	anim.Delay[len(anim.Delay)-1] += int(holdLast / (10 * time.Millisecond))
+	return gif.EncodeAll(w, anim)
+}
+
+// RenderAPNG reads every source and writes an animated PNG of the tracks being
+// drawn
+func (r *Renderer) RenderAPNG(sources []track.Source, w io.Writer) error {
+	frames := r.Config.Frames()
+	enc := apng.NewEncoder(w, frames)
+	delay := time.Second / time.Duration(r.Config.FPS)
+	i := 0
+	err := r.RenderFrames(sources, func(img *image.RGBA) error {
+		i++
+		if i == frames {
+			return enc.Add(img, delay+holdLast)
+		}
+		return enc.Add(img, delay)
+	})
+	if err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// saveFrames renders an animation as numbered PNG files, e.g. to make a video
+// with ffmpeg
+func saveFrames(r *Renderer, sources []track.Source, pattern string) error {
+	if err := os.MkdirAll(filepath.Dir(pattern), 0755); err != nil {
+		return err
+	}
+	i := 0
+	return r.RenderFrames(sources, func(img *image.RGBA) error {
+		name := config.FrameFile(pattern, i)
+		i++
+		return gg.SavePNG(name, img)
+	})
+}
+
+// changed is the smallest rectangle holding every pixel that differs between
+// two frames, at least one pixel as GIF frames can't be empty
+func changed(a, b *image.RGBA) image.Rectangle {
+	rect := image.Rectangle{}
+	bounds := b.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		rowA := a.Pix[a.PixOffset(bounds.Min.X, y):a.PixOffset(bounds.Max.X, y)]
+		rowB := b.Pix[b.PixOffset(bounds.Min.X, y):b.PixOffset(bounds.Max.X, y)]
+		for i := 0; i < len(rowB); i += 4 {
+			if rowA[i] != rowB[i] || rowA[i+1] != rowB[i+1] || rowA[i+2] != rowB[i+2] || rowA[i+3] != rowB[i+3] {
+				x := bounds.Min.X + i/4
+				rect = rect.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	if rect.Empty() {
+		return image.Rect(bounds.Min.X, bounds.Min.Y, bounds.Min.X+1, bounds.Min.Y+1)
+	}
+	return rect
+}
+
+// animPath is a track's colored path, with when each of its points appears, from
+// 0 at the start of the animation to 1 at the end
+type animPath struct {
+	cp    *colorpath.ColorPath
+	clock []float64
+}
+
+// animPaths works out when each point of the tracks appears.  Progressive
+// animations draw the tracks in the order they were recorded, skipping the time
+// between them.  Races start every track at once.  Paths without timestamps
+// are drawn at an even pace over the whole animation.
+func animPaths(animation string, paths []*colorpath.ColorPath) []animPath {
+	// the times of the animation, with the gaps squeezed out when progressive
+	spans := [][2]time.Time{}
+	for _, cp := range paths {
+		if first, last, ok := timeRange(cp); ok {
+			if animation == config.ANIMATION_RACE && !cp.Start.IsZero() {
+				first = cp.Start
+			}
+			spans = append(spans, [2]time.Time{first, last})
+		}
+	}
+	var elapsed func(cp *colorpath.ColorPath, t time.Time) time.Duration
+	var total time.Duration
+	if animation == config.ANIMATION_RACE {
+		for _, span := range spans {
+			if d := span[1].Sub(span[0]); d > total {
+				total = d
+			}
+		}
+		elapsed = func(cp *colorpath.ColorPath, t time.Time) time.Duration {
+			start := cp.Start
+			if start.IsZero() {
+				start, _, _ = timeRange(cp)
+			}
+			return t.Sub(start)
+		}
+	} else {
+		spans = mergeSpans(spans)
+		for _, span := range spans {
+			total += span[1].Sub(span[0])
+		}
+		elapsed = func(cp *colorpath.ColorPath, t time.Time) time.Duration {
+			d := time.Duration(0)
+			for _, span := range spans {
+				if !t.After(span[0]) {
+					break
+				}
+				if t.Before(span[1]) {
+					return d + t.Sub(span[0])
+				}
+				d += span[1].Sub(span[0])
+			}
+			return d
+		}
+	}
+
+	animated := make([]animPath, 0, len(paths))
+	for _, cp := range paths {
+		ap := animPath{cp: cp, clock: make([]float64, len(cp.Positions))}
+		_, _, timed := timeRange(cp)
+		timed = timed && total > 0
+		for i, pos := range cp.Positions {
+			switch {
+			case !timed && len(cp.Positions) > 1:
+				ap.clock[i] = float64(i) / float64(len(cp.Positions)-1)
+			case !timed:
+				ap.clock[i] = 0
+			case pos.Time.IsZero() && i > 0:
+				ap.clock[i] = ap.clock[i-1]
+			case pos.Time.IsZero():
+				first, _, _ := timeRange(cp)
+				ap.clock[i] = math.Max(0, float64(elapsed(cp, first))/float64(total))
+			default:
+				ap.clock[i] = math.Max(0, float64(elapsed(cp, pos.Time))/float64(total))
+			}
+			// a clock that went backwards would hide points already drawn
+			if i > 0 && ap.clock[i] < ap.clock[i-1] {
+				ap.clock[i] = ap.clock[i-1]
+			}
+		}
+		animated = append(animated, ap)
+	}
+	return animated
+}
+
+// timeRange is the first and last timestamps of a path
+func timeRange(cp *colorpath.ColorPath) (time.Time, time.Time, bool) {
+	var first, last time.Time
+	for _, pos := range cp.Positions {
+		if pos.Time.IsZero() {
+			continue
+		}
+		if first.IsZero() {
+			first = pos.Time
+		}
+		last = pos.Time
+	}
+	return first, last, !first.IsZero()
+}
+
+// mergeSpans sorts time spans and joins the ones that overlap
+func mergeSpans(spans [][2]time.Time) [][2]time.Time {
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i][0].Before(spans[j][0])
+	})
+	merged := [][2]time.Time{}
+	for _, span := range spans {
+		if n := len(merged); n > 0 && !span[0].After(merged[n-1][1]) {
+			if span[1].After(merged[n-1][1]) {
+				merged[n-1][1] = span[1]
+			}
+			continue
+		}
+		merged = append(merged, span)
+	}
+	return merged
+}
+
+// at is the part of the path drawn by clock, ending partway along the segment
+// being drawn.  With fade, older parts are split off into paths that are more
+// see through, fade is how long they take to disappear in the same units as
+// clock.
+func (ap animPath) at(clock, fade float64) []*colorpath.ColorPath {
+	n := sort.SearchFloat64s(ap.clock, math.Nextafter(clock, math.Inf(1)))
+	if n == 0 {
+		return nil
+	}
+	points := append([]colorpath.Point{}, ap.cp.Positions[:n]...)
+	ages := make([]float64, n, n+1)
+	for i := range ages {
+		ages[i] = clock - ap.clock[i]
+	}
+	if n < len(ap.clock) && ap.clock[n] > ap.clock[n-1] {
+		f := (clock - ap.clock[n-1]) / (ap.clock[n] - ap.clock[n-1])
+		a, b := ap.cp.Positions[n-1], ap.cp.Positions[n]
+		head := a
+		head.LatLng = s2.LatLng{
+			Lat: a.Lat + s1.Angle(f*float64(b.Lat-a.Lat)),
+			Lng: a.Lng + s1.Angle(f*float64(b.Lng-a.Lng)),
+		}
+		points = append(points, head)
+		ages = append(ages, 0)
+	}
+
+	step := func(i int) int {
+		if fade <= 0 {
+			return 0
+		}
+		return int(math.Min(fadeSteps, math.Floor(ages[i]/fade*fadeSteps)))
+	}
+	// each line between two points fades from when it was finished, at the
+	// second point
+	parts := []*colorpath.ColorPath{}
+	for start := 0; start < len(points)-1; {
+		s := step(start + 1)
+		end := start + 1
+		for end < len(points)-1 && step(end+1) == s {
+			end++
+		}
+		if s < fadeSteps {
+			part := colorpath.NewColorPath(ap.cp.Weight)
+			part.Positions = points[start : end+1]
+			part.Fade = float64(s) / fadeSteps
+			parts = append(parts, part)
+		}
+		start = end
+	}
+	return parts
+}
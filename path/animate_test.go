@@ -0,0 +1,68 @@
+package path
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/geo/s2"
+	"github.com/meekmichael/gpxrainbow/colorpath"
+	"github.com/meekmichael/gpxrainbow/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// timedPath is a path with a point every minute from start
+func timedPath(start time.Time, points int) *colorpath.ColorPath {
+	cp := colorpath.NewColorPath(3)
+	cp.Start = start
+	for i := 0; i < points; i++ {
+		cp.Positions = append(cp.Positions, colorpath.Point{
+			LatLng: s2.LatLngFromDegrees(45+float64(i)*0.001, -93),
+			Time:   start.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	return cp
+}
+
+func TestAnimPaths(t *testing.T) {
+	day := time.Date(2020, 6, 1, 8, 0, 0, 0, time.UTC)
+	// 10 minutes, then a day later 30 minutes, and one without timestamps
+	untimed := colorpath.NewColorPath(3)
+	for i := 0; i < 3; i++ {
+		untimed.Positions = append(untimed.Positions, colorpath.Point{LatLng: s2.LatLngFromDegrees(45, -93+float64(i)*0.001)})
+	}
+	paths := []*colorpath.ColorPath{timedPath(day, 11), timedPath(day.Add(24*time.Hour), 31), untimed}
+
+	// progressive skips the day between the tracks
+	ap := animPaths(config.ANIMATION_PROGRESSIVE, paths)
+	assert.InDelta(t, 0, ap[0].clock[0], 1e-9)
+	assert.InDelta(t, 0.25, ap[0].clock[10], 1e-9)
+	assert.InDelta(t, 0.25, ap[1].clock[0], 1e-9)
+	assert.InDelta(t, 1, ap[1].clock[30], 1e-9)
+	assert.Equal(t, []float64{0, 0.5, 1}, ap[2].clock)
+
+	// races start together and end when the longest track does
+	ap = animPaths(config.ANIMATION_RACE, paths)
+	assert.InDelta(t, 0, ap[1].clock[0], 1e-9)
+	assert.InDelta(t, 1.0/3, ap[0].clock[10], 1e-9)
+	assert.InDelta(t, 1, ap[1].clock[30], 1e-9)
+}
+
+func TestAnimPathAt(t *testing.T) {
+	ap := animPaths(config.ANIMATION_PROGRESSIVE, []*colorpath.ColorPath{timedPath(time.Now(), 11)})[0]
+	assert.Empty(t, ap.at(-0.1, 0))
+
+	// halfway along a segment, the head is halfway too
+	parts := ap.at(0.25, 0)
+	assert.Len(t, parts, 1)
+	assert.Len(t, parts[0].Positions, 4)
+	assert.InDelta(t, 45.0025, parts[0].Positions[3].Lat.Degrees(), 1e-9)
+
+	// with fade, old lines are more see through and the oldest are gone
+	parts = ap.at(1, 0.5)
+	assert.True(t, len(parts) > 1)
+	assert.Equal(t, 0.0, parts[len(parts)-1].Fade)
+	for i := 1; i < len(parts); i++ {
+		assert.Less(t, parts[i].Fade, parts[i-1].Fade)
+	}
+	assert.InDelta(t, 45.005, parts[0].Positions[0].Lat.Degrees(), 1e-9)
+}
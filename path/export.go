@@ -0,0 +1,247 @@
+package path
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/golang/geo/s2"
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/meekmichael/gpxrainbow/colorpath"
+	"github.com/meekmichael/gpxrainbow/marker"
+	"github.com/meekmichael/gpxrainbow/track"
+)
+
+// exporting the colored paths as data for other mapping programs.  Every line
+// between two points of a track is its own feature, with the color it's drawn
+// in and the value of its first point, the way the map draws it.  The last
+// point of a track is a point feature, so its value isn't lost and a track of
+// a single point is still there.
+
+type geoJSONCollection struct {
+	Type     string           `json:"type"`
+	Name     string           `json:"name"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   geoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoJSONGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// RenderGeoJSON reads every source and writes the colored paths as a GeoJSON
+// FeatureCollection.  Track lines and the last point of each track have the
+// file, color, value (in the units of the legend, null if unknown) and label
+// shown for the value, planned routes a file, color and planned, and waypoints
+// a name.
+func (r *Renderer) RenderGeoJSON(sources []track.Source, w io.Writer) error {
+	sc, err := r.scene(sources)
+	if err != nil {
+		return err
+	}
+	label := sc.labeler()
+	fc := geoJSONCollection{Type: "FeatureCollection", Name: sc.title(), Features: []geoJSONFeature{}}
+	for _, obj := range sc.objects {
+		switch o := obj.(type) {
+		case *colorpath.ColorPath:
+			fc.Features = append(fc.Features, segmentFeatures(o, label)...)
+		case *marker.Labeled:
+			fc.Features = append(fc.Features, geoJSONFeature{
+				Type:       "Feature",
+				Geometry:   geoJSONGeometry{Type: "Point", Coordinates: lngLat(o.Position)},
+				Properties: map[string]interface{}{"name": o.Name},
+			})
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(fc)
+}
+
+// segmentFeatures are the lines of a path as GeoJSON LineStrings followed by
+// its last point, a planned route is one LineString
+func segmentFeatures(cp *colorpath.ColorPath, label func(float64) string) []geoJSONFeature {
+	if len(cp.Positions) == 0 || (len(cp.Dash) > 0 && len(cp.Positions) < 2) {
+		return nil
+	}
+	if len(cp.Dash) > 0 {
+		coords := make([][2]float64, len(cp.Positions))
+		for i, pos := range cp.Positions {
+			coords[i] = lngLat(pos.LatLng)
+		}
+		return []geoJSONFeature{{
+			Type:       "Feature",
+			Geometry:   geoJSONGeometry{Type: "LineString", Coordinates: coords},
+			Properties: map[string]interface{}{"file": cp.Name, "color": cp.Positions[0].Color.Hex(), "planned": true},
+		}}
+	}
+	props := func(pt colorpath.Point) map[string]interface{} {
+		p := map[string]interface{}{"file": cp.Name, "color": pt.Color.Hex(), "value": nil, "label": nil}
+		if !math.IsNaN(pt.Value) {
+			p["value"] = pt.Value
+			p["label"] = label(pt.Value)
+		}
+		return p
+	}
+	features := make([]geoJSONFeature, len(cp.Positions))
+	for i := 0; i < len(cp.Positions)-1; i++ {
+		a, b := cp.Positions[i], cp.Positions[i+1]
+		features[i] = geoJSONFeature{
+			Type:       "Feature",
+			Geometry:   geoJSONGeometry{Type: "LineString", Coordinates: [][2]float64{lngLat(a.LatLng), lngLat(b.LatLng)}},
+			Properties: props(a),
+		}
+	}
+	last := cp.Positions[len(cp.Positions)-1]
+	features[len(features)-1] = geoJSONFeature{
+		Type:       "Feature",
+		Geometry:   geoJSONGeometry{Type: "Point", Coordinates: lngLat(last.LatLng)},
+		Properties: props(last),
+	}
+	return features
+}
+
+// lngLat is a GeoJSON position, to about 10cm
+func lngLat(ll s2.LatLng) [2]float64 {
+	return [2]float64{math.Round(ll.Lng.Degrees()*1e6) / 1e6, math.Round(ll.Lat.Degrees()*1e6) / 1e6}
+}
+
+// RenderKML reads every source and writes the colored paths as KML, e.g. for
+// Google Earth.  Each file is a folder of LineStrings styled in their colors,
+// with the value and label as extended data, and the waypoints are placemarks
+// in a folder of their own.
+func (r *Renderer) RenderKML(sources []track.Source, w io.Writer) error {
+	sc, err := r.scene(sources)
+	if err != nil {
+		return err
+	}
+	label := sc.labeler()
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<kml xmlns=\"http://www.opengis.net/kml/2.2\">\n<Document>\n<name>%s</name>\n", escapeXML(sc.title()))
+
+	// a style for each color, the planned routes see through like they're drawn
+	styles := map[string]bool{}
+	for _, obj := range sc.objects {
+		cp, ok := obj.(*colorpath.ColorPath)
+		if !ok {
+			continue
+		}
+		for _, pos := range cp.Positions {
+			id := kmlStyle(pos.Color, len(cp.Dash) > 0)
+			if !styles[id] {
+				styles[id] = true
+				alpha := 0xff
+				if len(cp.Dash) > 0 {
+					alpha = 0xaa
+				}
+				fmt.Fprintf(bw, "<Style id=\"%s\"><IconStyle><color>%s</color><scale>0.5</scale></IconStyle><LineStyle><color>%s</color><width>%d</width></LineStyle></Style>\n",
+					id, kmlColor(pos.Color, alpha), kmlColor(pos.Color, alpha), r.Config.LineWidth)
+			}
+		}
+	}
+
+	// one folder for each file, in the order the files first come up, as
+	// planned routes are drawn first and overlap mode sorts the paths
+	names := []string{}
+	folders := map[string][]*colorpath.ColorPath{}
+	waypoints := []*marker.Labeled{}
+	for _, obj := range sc.objects {
+		switch o := obj.(type) {
+		case *colorpath.ColorPath:
+			if len(o.Positions) == 0 || (len(o.Dash) > 0 && len(o.Positions) < 2) {
+				continue
+			}
+			if _, ok := folders[o.Name]; !ok {
+				names = append(names, o.Name)
+			}
+			folders[o.Name] = append(folders[o.Name], o)
+		case *marker.Labeled:
+			waypoints = append(waypoints, o)
+		}
+	}
+	for _, name := range names {
+		fmt.Fprintf(bw, "<Folder>\n<name>%s</name>\n", escapeXML(name))
+		for _, cp := range folders[name] {
+			writeKMLPath(bw, cp, label)
+		}
+		fmt.Fprint(bw, "</Folder>\n")
+	}
+	if len(waypoints) > 0 {
+		fmt.Fprint(bw, "<Folder>\n<name>waypoints</name>\n")
+		for _, wpt := range waypoints {
+			fmt.Fprintf(bw, "<Placemark><name>%s</name><Point><coordinates>%s</coordinates></Point></Placemark>\n",
+				escapeXML(wpt.Name), kmlCoordinates(wpt.Position))
+		}
+		fmt.Fprint(bw, "</Folder>\n")
+	}
+	fmt.Fprint(bw, "</Document>\n</kml>\n")
+	return bw.Flush()
+}
+
+// writeKMLPath writes a placemark for each line of a path and its last point,
+// or one for a planned route
+func writeKMLPath(w io.Writer, cp *colorpath.ColorPath, label func(float64) string) {
+	if len(cp.Dash) > 0 {
+		coords := make([]string, len(cp.Positions))
+		for i, pos := range cp.Positions {
+			coords[i] = kmlCoordinates(pos.LatLng)
+		}
+		fmt.Fprintf(w, "<Placemark><name>planned route</name><styleUrl>#%s</styleUrl><LineString><tessellate>1</tessellate><coordinates>%s</coordinates></LineString></Placemark>\n",
+			kmlStyle(cp.Positions[0].Color, true), strings.Join(coords, " "))
+		return
+	}
+	data := func(v float64) string {
+		if math.IsNaN(v) {
+			return ""
+		}
+		return fmt.Sprintf("<ExtendedData><Data name=\"value\"><value>%s</value></Data><Data name=\"label\"><value>%s</value></Data></ExtendedData>",
+			strconv.FormatFloat(v, 'f', -1, 64), escapeXML(label(v)))
+	}
+	for i := 0; i < len(cp.Positions)-1; i++ {
+		a, b := cp.Positions[i], cp.Positions[i+1]
+		fmt.Fprintf(w, "<Placemark><styleUrl>#%s</styleUrl>%s<LineString><tessellate>1</tessellate><coordinates>%s %s</coordinates></LineString></Placemark>\n",
+			kmlStyle(a.Color, false), data(a.Value),
+			kmlCoordinates(a.LatLng), kmlCoordinates(b.LatLng))
+	}
+	last := cp.Positions[len(cp.Positions)-1]
+	fmt.Fprintf(w, "<Placemark><styleUrl>#%s</styleUrl>%s<Point><coordinates>%s</coordinates></Point></Placemark>\n",
+		kmlStyle(last.Color, false), data(last.Value), kmlCoordinates(last.LatLng))
+}
+
+// kmlStyle is the id of the style for lines of a color
+func kmlStyle(c colorful.Color, planned bool) string {
+	if planned {
+		return "planned" + c.Hex()[1:]
+	}
+	return "c" + c.Hex()[1:]
+}
+
+// kmlColor is a color the way KML writes them, alpha, blue, green then red
+func kmlColor(c colorful.Color, alpha int) string {
+	r, g, b := c.RGB255()
+	return fmt.Sprintf("%02x%02x%02x%02x", alpha, b, g, r)
+}
+
+// kmlCoordinates is a KML position, to about 10cm
+func kmlCoordinates(ll s2.LatLng) string {
+	pos := lngLat(ll)
+	return strconv.FormatFloat(pos[0], 'f', -1, 64) + "," + strconv.FormatFloat(pos[1], 'f', -1, 64)
+}
+
+// escapeXML is text escaped to go in XML
+func escapeXML(s string) string {
+	b := strings.Builder{}
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,222 @@
+package path
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/golang/geo/s2"
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/meekmichael/gpxrainbow/colorpath"
+	"github.com/meekmichael/gpxrainbow/config"
+	"github.com/meekmichael/gpxrainbow/tile"
+	"github.com/meekmichael/gpxrainbow/track"
+	"github.com/stretchr/testify/assert"
+)
+
+func exportPath() *colorpath.ColorPath {
+	cp := colorpath.NewColorPath(5)
+	cp.Name = "ride & run.gpx"
+	cp.Positions = []colorpath.Point{
+		{LatLng: s2.LatLngFromDegrees(45, -93), Color: colorful.Color{R: 1}, Value: 1.5},
+		{LatLng: s2.LatLngFromDegrees(45.01, -93.02), Color: colorful.Color{B: 1}, Value: math.NaN()},
+		{LatLng: s2.LatLngFromDegrees(45.02, -93.03), Color: colorful.Color{B: 1}, Value: 3},
+	}
+	return cp
+}
+
+func exportLabel(v float64) string {
+	return fmt.Sprintf("%.1f <mph>", v)
+}
+
+func TestSegmentFeatures(t *testing.T) {
+	cp := exportPath()
+	features := segmentFeatures(cp, exportLabel)
+	assert.Len(t, features, 3)
+	assert.Equal(t, [][2]float64{{-93, 45}, {-93.02, 45.01}}, features[0].Geometry.Coordinates)
+	assert.Equal(t, map[string]interface{}{"file": "ride & run.gpx", "color": "#ff0000", "value": 1.5, "label": "1.5 <mph>"}, features[0].Properties)
+	// no value is null, not NaN which JSON can't hold
+	assert.Nil(t, features[1].Properties["value"])
+	assert.Nil(t, features[1].Properties["label"])
+	// the last point has its own value
+	assert.Equal(t, "Point", features[2].Geometry.Type)
+	assert.Equal(t, [2]float64{-93.03, 45.02}, features[2].Geometry.Coordinates)
+	assert.Equal(t, 3.0, features[2].Properties["value"])
+	assert.Equal(t, "#0000ff", features[2].Properties["color"])
+
+	cp.Dash = []float64{8, 6}
+	features = segmentFeatures(cp, exportLabel)
+	assert.Len(t, features, 1)
+	assert.Len(t, features[0].Geometry.Coordinates, 3)
+	assert.Equal(t, true, features[0].Properties["planned"])
+
+	cp.Positions = cp.Positions[:1]
+	assert.Empty(t, segmentFeatures(cp, exportLabel))
+
+	// a track of one point is a point
+	cp.Dash = nil
+	features = segmentFeatures(cp, exportLabel)
+	assert.Len(t, features, 1)
+	assert.Equal(t, "Point", features[0].Geometry.Type)
+	assert.Equal(t, [2]float64{-93, 45}, features[0].Geometry.Coordinates)
+	assert.Equal(t, 1.5, features[0].Properties["value"])
+	assert.Equal(t, "1.5 <mph>", features[0].Properties["label"])
+}
+
+func TestKMLPath(t *testing.T) {
+	assert.Equal(t, "ff0000ff", kmlColor(colorful.Color{R: 1}, 0xff))
+	assert.Equal(t, "80ff8000", kmlColor(colorful.Color{G: 0.5, B: 1}, 0x80))
+
+	buf := bytes.Buffer{}
+	writeKMLPath(&buf, exportPath(), exportLabel)
+	var doc struct {
+		Placemarks []struct {
+			Style string `xml:"styleUrl"`
+			Data  []struct {
+				Name  string `xml:"name,attr"`
+				Value string `xml:"value"`
+			} `xml:"ExtendedData>Data"`
+			Coordinates string `xml:"LineString>coordinates"`
+			Point       string `xml:"Point>coordinates"`
+		} `xml:"Placemark"`
+	}
+	assert.NoError(t, xml.Unmarshal([]byte("<doc>"+buf.String()+"</doc>"), &doc))
+	assert.Len(t, doc.Placemarks, 3)
+	assert.Equal(t, "#cff0000", doc.Placemarks[0].Style)
+	assert.Equal(t, "-93,45 -93.02,45.01", doc.Placemarks[0].Coordinates)
+	assert.Len(t, doc.Placemarks[0].Data, 2)
+	assert.Equal(t, "1.5", doc.Placemarks[0].Data[0].Value)
+	assert.Equal(t, "1.5 <mph>", doc.Placemarks[0].Data[1].Value)
+	assert.Equal(t, "#c0000ff", doc.Placemarks[1].Style)
+	assert.Empty(t, doc.Placemarks[1].Data)
+	assert.Equal(t, "#c0000ff", doc.Placemarks[2].Style)
+	assert.Equal(t, "-93.03,45.02", doc.Placemarks[2].Point)
+	assert.Equal(t, "3", doc.Placemarks[2].Data[0].Value)
+}
+
+// TestRenderKML checks the waypoints aren't put in the folder of a file
+func TestRenderKML(t *testing.T) {
+	opts := config.DefaultOptions()
+	opts.TileProvider = tile.NONE
+	opts.Mode = config.MODE_ELEVATION
+	r, err := NewRenderer(opts)
+	if !assert.NoError(t, err) {
+		return
+	}
+	buf := bytes.Buffer{}
+	assert.NoError(t, r.RenderKML([]track.Source{
+		track.ReaderSource("a.gpx", strings.NewReader(testGPX)),
+		track.ReaderSource("b.gpx", strings.NewReader(testGPX)),
+	}, &buf))
+	var doc struct {
+		Folders []struct {
+			Name       string `xml:"name"`
+			Placemarks []struct {
+				Name  string `xml:"name"`
+				Point string `xml:"Point>coordinates"`
+			} `xml:"Placemark"`
+		} `xml:"Document>Folder"`
+	}
+	assert.NoError(t, xml.Unmarshal(buf.Bytes(), &doc))
+	if !assert.Len(t, doc.Folders, 3) {
+		return
+	}
+	assert.Equal(t, "a.gpx", doc.Folders[0].Name)
+	assert.Equal(t, "b.gpx", doc.Folders[1].Name)
+	// two lines and the end of the track
+	assert.Len(t, doc.Folders[1].Placemarks, 3)
+	assert.Equal(t, "waypoints", doc.Folders[2].Name)
+	assert.Len(t, doc.Folders[2].Placemarks, 2)
+	assert.Equal(t, "lunch", doc.Folders[2].Placemarks[0].Name)
+}
+
+// TestRenderKMLFolders checks each file is one folder, even with its planned
+// route drawn before every track and overlap mode sorting the paths
+func TestRenderKMLFolders(t *testing.T) {
+	planned := func(lat string) string {
+		return `<gpx version="1.1" xmlns="http://www.topografix.com/GPX/1/1">
+<rte><rtept lat="45.000" lon="-93.000"></rtept><rtept lat="45.020" lon="-93.010"></rtept></rte>
+<trk><trkseg><trkpt lat="` + lat + `" lon="-93.000"></trkpt><trkpt lat="45.010" lon="-93.020"></trkpt></trkseg>
+<trkseg><trkpt lat="45.030" lon="-93.000"></trkpt><trkpt lat="45.040" lon="-93.020"></trkpt></trkseg></trk>
+</gpx>`
+	}
+	for _, mode := range []string{config.MODE_PROXIMITY, config.MODE_OVERLAP} {
+		opts := config.DefaultOptions()
+		opts.TileProvider = tile.NONE
+		opts.Mode = mode
+		r, err := NewRenderer(opts)
+		if !assert.NoError(t, err) {
+			return
+		}
+		buf := bytes.Buffer{}
+		assert.NoError(t, r.RenderKML([]track.Source{
+			track.ReaderSource("a.gpx", strings.NewReader(planned("45.000"))),
+			track.ReaderSource("b.gpx", strings.NewReader(planned("45.001"))),
+		}, &buf))
+		var doc struct {
+			Folders []struct {
+				Name       string   `xml:"name"`
+				Placemarks []string `xml:"Placemark>styleUrl"`
+			} `xml:"Document>Folder"`
+		}
+		assert.NoError(t, xml.Unmarshal(buf.Bytes(), &doc))
+		if !assert.Len(t, doc.Folders, 2, mode) {
+			continue
+		}
+		for i, name := range []string{"a.gpx", "b.gpx"} {
+			assert.Equal(t, name, doc.Folders[i].Name, mode)
+			// the route, and a line and the last point of each segment
+			assert.Len(t, doc.Folders[i].Placemarks, 5, mode)
+		}
+	}
+}
+
+// TestRenderGeoJSONInput checks input mode exports each track's number and
+// label once, however many segments it has
+func TestRenderGeoJSONInput(t *testing.T) {
+	single := func(lat string) string {
+		return `<gpx version="1.1" xmlns="http://www.topografix.com/GPX/1/1"><trk><trkseg>
+<trkpt lat="` + lat + `" lon="-93.000"></trkpt><trkpt lat="` + lat + `" lon="-93.010"></trkpt>
+</trkseg></trk></gpx>`
+	}
+	paused := `<gpx version="1.1" xmlns="http://www.topografix.com/GPX/1/1"><trk>
+<trkseg><trkpt lat="45.020" lon="-93.000"></trkpt><trkpt lat="45.020" lon="-93.010"></trkpt></trkseg>
+<trkseg><trkpt lat="45.030" lon="-93.000"></trkpt><trkpt lat="45.030" lon="-93.010"></trkpt></trkseg>
+</trk></gpx>`
+	opts := config.DefaultOptions()
+	opts.TileProvider = tile.NONE
+	opts.Mode = config.MODE_INPUT
+	r, err := NewRenderer(opts)
+	if !assert.NoError(t, err) {
+		return
+	}
+	buf := bytes.Buffer{}
+	assert.NoError(t, r.RenderGeoJSON([]track.Source{
+		track.ReaderSource("a.gpx", strings.NewReader(single("45.000"))),
+		track.ReaderSource("b.gpx", strings.NewReader(single("45.010"))),
+		track.ReaderSource("c.gpx", strings.NewReader(paused)),
+	}, &buf))
+	var fc struct {
+		Features []struct {
+			Properties struct {
+				File  string  `json:"file"`
+				Value float64 `json:"value"`
+				Label string  `json:"label"`
+			} `json:"properties"`
+		} `json:"features"`
+	}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &fc))
+	want := map[string]float64{"a.gpx": 1, "b.gpx": 2, "c.gpx": 3}
+	// a line and the last point of each segment
+	if !assert.Len(t, fc.Features, 8) {
+		return
+	}
+	for _, f := range fc.Features {
+		assert.Equal(t, want[f.Properties.File], f.Properties.Value, f.Properties.File)
+		assert.Equal(t, fmt.Sprintf("track %.0f", want[f.Properties.File]), f.Properties.Label, f.Properties.File)
+	}
+}
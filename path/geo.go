@@ -0,0 +1,96 @@
+package path
+
+import (
+	"fmt"
+	"image"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/geo/s2"
+	"github.com/meekmichael/gpxrainbow/legend"
+	"github.com/meekmichael/gpxrainbow/track"
+)
+
+// earthRadius is the sphere Web Mercator projects, in meters
+const earthRadius = 6378137
+
+// WebMercatorWKT is the .prj file for Web Mercator (EPSG:3857), the projection
+// of every tile provider
+const WebMercatorWKT = `PROJCS["WGS 84 / Pseudo-Mercator",GEOGCS["WGS 84",DATUM["WGS_1984",SPHEROID["WGS 84",6378137,298.257223563,AUTHORITY["EPSG","7030"]],AUTHORITY["EPSG","6326"]],PRIMEM["Greenwich",0,AUTHORITY["EPSG","8901"]],UNIT["degree",0.0174532925199433,AUTHORITY["EPSG","9122"]],AUTHORITY["EPSG","4326"]],PROJECTION["Mercator_1SP"],PARAMETER["central_meridian",0],PARAMETER["scale_factor",1],PARAMETER["false_easting",0],PARAMETER["false_northing",0],UNIT["metre",1,AUTHORITY["EPSG","9001"]],AXIS["X",EAST],AXIS["Y",NORTH],EXTENSION["PROJ4","+proj=merc +a=6378137 +b=6378137 +lat_ts=0.0 +lon_0=0.0 +x_0=0.0 +y_0=0 +k=1.0 +units=m +nadgrids=@null +wktext +no_defs"],AUTHORITY["EPSG","3857"]]`
+
+// WorldFile places an image in Web Mercator meters, for GIS programs like QGIS
+type WorldFile struct {
+	// PixelSize is the width and height of a pixel in meters
+	PixelSize float64
+	// X, Y is the center of the top left pixel
+	X, Y float64
+}
+
+// String is the six lines of a world file
+func (wf WorldFile) String() string {
+	return fmt.Sprintf("%.10f\n0.0\n0.0\n%.10f\n%.10f\n%.10f\n", wf.PixelSize, -wf.PixelSize, wf.X, wf.Y)
+}
+
+// Save writes the world file and its .prj beside an image file
+func (wf WorldFile) Save(imageFile string) error {
+	if err := ioutil.WriteFile(WorldFileName(imageFile), []byte(wf.String()), 0644); err != nil {
+		return err
+	}
+	base := strings.TrimSuffix(imageFile, filepath.Ext(imageFile))
+	return ioutil.WriteFile(base+".prj", []byte(WebMercatorWKT+"\n"), 0644)
+}
+
+// WorldFileName is the usual world file name for an image, .pgw for a .png or
+// .jgw for a .jpg
+func WorldFileName(imageFile string) string {
+	ext := filepath.Ext(imageFile)
+	w := "w"
+	if len(ext) >= 3 {
+		w = ext[:2] + ext[len(ext)-1:] + "w"
+	}
+	return strings.TrimSuffix(imageFile, ext) + w
+}
+
+// RenderGeo is Render that also returns where the image is on the earth
+func (r *Renderer) RenderGeo(sources []track.Source) (image.Image, WorldFile, error) {
+	sc, err := r.scene(sources)
+	if err != nil {
+		return nil, WorldFile{}, err
+	}
+	// pinned, the view is known before rendering and is what gets drawn
+	v, err := r.fixView(sc)
+	if err != nil {
+		return nil, WorldFile{}, err
+	}
+	img, err := r.renderMap(sc, sc.objects)
+	if err != nil {
+		return nil, WorldFile{}, err
+	}
+	if sc.legend != nil {
+		if img, err = legend.Render(*sc.legend, img); err != nil {
+			return nil, WorldFile{}, err
+		}
+	}
+	return img, v.worldFile(), nil
+}
+
+// worldFile works out the top left pixel from the center, whose pixel and
+// meters are both known
+func (v *view) worldFile() WorldFile {
+	size := 2 * math.Pi * earthRadius / (float64(v.tileSize) * math.Exp2(float64(v.zoom)))
+	px, py := v.project(v.center)
+	mx, my := mercator(v.center)
+	return WorldFile{
+		PixelSize: size,
+		X:         mx + (0.5-px)*size,
+		Y:         my - (0.5-py)*size,
+	}
+}
+
+// mercator is the Web Mercator x, y of ll in meters
+func mercator(ll s2.LatLng) (float64, float64) {
+	lat := ll.Lat.Radians()
+	return earthRadius * ll.Lng.Radians(), earthRadius * math.Log(math.Tan(math.Pi/4+lat/2))
+}
@@ -0,0 +1,44 @@
+package path
+
+import (
+	"testing"
+
+	sm "github.com/flopp/go-staticmaps"
+	"github.com/golang/geo/s2"
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/meekmichael/gpxrainbow/colorpath"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestWorldFile checks that the world file puts coordinates on the pixels
+// go-staticmaps draws them on
+func TestWorldFile(t *testing.T) {
+	provider, closeTiles := testTiles()
+	defer closeTiles()
+	cp := colorpath.NewColorPath(3)
+	lls := []s2.LatLng{s2.LatLngFromDegrees(44.9, -93.3), s2.LatLngFromDegrees(45.1, -92.9), s2.LatLngFromDegrees(44.95, -93.05)}
+	for _, ll := range lls {
+		cp.Positions = append(cp.Positions, colorpath.Point{LatLng: ll, Color: colorful.Color{R: 1}})
+	}
+	ctx := sm.NewContext()
+	ctx.SetSize(640, 480)
+	ctx.SetTileProvider(provider)
+	ctx.SetCache(nil)
+	ctx.AddObject(cp)
+	v, err := fixView(ctx, []sm.MapObject{cp}, 640, 480, 256)
+	assert.NoError(t, err)
+
+	wf := v.worldFile()
+	for _, ll := range lls {
+		x, y := v.project(ll)
+		mx, my := mercator(ll)
+		assert.InDelta(t, x, (mx-wf.X)/wf.PixelSize+0.5, 0.01)
+		assert.InDelta(t, y, (wf.Y-my)/wf.PixelSize+0.5, 0.01)
+	}
+}
+
+func TestWorldFileName(t *testing.T) {
+	assert.Equal(t, "out/map.pgw", WorldFileName("out/map.png"))
+	assert.Equal(t, "map.jgw", WorldFileName("map.jpg"))
+	assert.Equal(t, "map.jgw", WorldFileName("map.jpeg"))
+}
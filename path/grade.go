@@ -0,0 +1,54 @@
+package path
+
+import (
+	"github.com/meekmichael/gpxrainbow/track"
+	"github.com/tkrajina/gpxgo/gpx"
+)
+
+// minGradeRun is the shortest horizontal distance (meters) a grade is computed
+// over, anything shorter is mostly GPS noise
+const minGradeRun = 5.0
+
+// segmentGrades computes the percent grade at each point of a segment.  GPS
+// elevation is noisy, so the grade at a point is the elevation change over the
+// horizontal distance between the points _window_ / 2 meters behind and ahead
+// of it.  Points without elevation, or without enough distance around them,
+// get a null grade.
+func segmentGrades(points []track.Point, window float64) []gpx.NullableFloat64 {
+	grades := make([]gpx.NullableFloat64, len(points))
+
+	// cumulative horizontal distance for the points that have an elevation
+	idx := []int{}
+	dist := []float64{}
+	total := 0.0
+	for i := range points {
+		if i > 0 {
+			total += points[i].Distance2D(&points[i-1])
+		}
+		if points[i].Elevation.NotNull() {
+			idx = append(idx, i)
+			dist = append(dist, total)
+		}
+	}
+
+	half := window / 2
+	back, ahead := 0, 0
+	for n := range idx {
+		for dist[n]-dist[back] > half {
+			back++
+		}
+		if ahead < n {
+			ahead = n
+		}
+		for ahead+1 < len(idx) && dist[ahead+1]-dist[n] <= half {
+			ahead++
+		}
+		run := dist[ahead] - dist[back]
+		if run < minGradeRun {
+			continue
+		}
+		rise := points[idx[ahead]].Elevation.Value() - points[idx[back]].Elevation.Value()
+		grades[idx[n]].SetValue(rise / run * 100)
+	}
+	return grades
+}
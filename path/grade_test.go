@@ -0,0 +1,36 @@
+package path
+
+import (
+	"testing"
+
+	"github.com/meekmichael/gpxrainbow/track"
+	"github.com/stretchr/testify/assert"
+	"github.com/tkrajina/gpxgo/gpx"
+)
+
+func TestSegmentGrades(t *testing.T) {
+	// ~11.1 meters apart heading north, climbing 1.11m each point: 10% grade
+	points := []track.Point{}
+	for i := 0; i < 20; i++ {
+		points = append(points, track.Point{
+			Latitude:  45 + float64(i)*0.0001,
+			Longitude: 45,
+			Elevation: *gpx.NewNullableFloat64(100 + float64(i)*1.112),
+		})
+	}
+	points[5].Elevation = gpx.NullableFloat64{}
+
+	grades := segmentGrades(points, 50)
+	assert.Len(t, grades, len(points))
+	for i, g := range grades {
+		if i == 5 {
+			assert.True(t, g.Null())
+			continue
+		}
+		assert.True(t, g.NotNull(), "point %d", i)
+		assert.InDelta(t, 10, g.Value(), 0.1, "point %d", i)
+	}
+
+	// too short a window for a single point
+	assert.True(t, segmentGrades(points[:1], 50)[0].Null())
+}
@@ -0,0 +1,123 @@
+package path
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/meekmichael/gpxrainbow/canvas"
+	"github.com/meekmichael/gpxrainbow/colorpath"
+	"github.com/meekmichael/gpxrainbow/track"
+)
+
+// htmlPage is the web page RenderHTML writes, {{TITLE}} and {{MAP}} are filled
+// in
+const htmlPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{TITLE}}</title>
+<style>
+body { margin: 0; background: #e4e4e4; }
+svg { display: block; margin: auto; max-width: 100%; height: auto; }
+</style>
+</head>
+<body>
+{{MAP}}</body>
+</html>
+`
+
+// hoverDistance is how many pixels off a track the pointer can be and still
+// show its tooltip
+const hoverDistance = 4
+
+// RenderHTML reads every source and writes a web page with the map on it, drawn
+// the way RenderSVG draws it.  Hovering over a track shows its value and the
+// file it came from.  The basemap is in the page and there are no scripts, so
+// it can be emailed or put on a website as is.
+func (r *Renderer) RenderHTML(sources []track.Source, w io.Writer) error {
+	sc, err := r.scene(sources)
+	if err != nil {
+		return err
+	}
+	svg := canvas.NewSVG(r.Config.ImageWidth, r.Config.ImageHeight)
+	v, err := r.drawVector(sc, svg)
+	if err != nil {
+		return err
+	}
+	label := sc.labeler()
+	for _, obj := range sc.objects {
+		if cp, ok := obj.(*colorpath.ColorPath); ok {
+			hoverPath(svg, cp, v.project, label)
+		}
+	}
+	doc := bytes.Buffer{}
+	if _, err := svg.WriteTo(&doc); err != nil {
+		return err
+	}
+	// in the page, without the XML declaration
+	m := strings.TrimPrefix(doc.String(), xml.Header)
+	page := strings.NewReplacer("{{TITLE}}", html.EscapeString(sc.title()), "{{MAP}}", m).Replace(htmlPage)
+	_, err = io.WriteString(w, page)
+	return err
+}
+
+// hoverPath puts tooltips over a path, one for each run of lines with the same
+// label, a planned route is one tooltip
+func hoverPath(svg *canvas.SVG, cp *colorpath.ColorPath, project canvas.Projection, label func(float64) string) {
+	if len(cp.Positions) <= 1 {
+		return
+	}
+	width := cp.Weight + 2*hoverDistance
+	x, y := project(cp.Positions[0].LatLng)
+	if len(cp.Dash) > 0 {
+		xy := []float64{x, y}
+		for _, pos := range cp.Positions[1:] {
+			x, y := project(pos.LatLng)
+			xy = append(xy, x, y)
+		}
+		svg.Hover(xy, width, "planned route\n"+cp.Name)
+		return
+	}
+
+	// like the colors, each line between two points has the label of the first
+	title := func(i int) string {
+		if v := cp.Positions[i].Value; !math.IsNaN(v) {
+			return label(v) + "\n" + cp.Name
+		}
+		return cp.Name
+	}
+	xy := []float64{x, y}
+	for i := 1; i < len(cp.Positions); i++ {
+		x, y := project(cp.Positions[i].LatLng)
+		xy = append(xy, x, y)
+		if i == len(cp.Positions)-1 || title(i) != title(i-1) {
+			svg.Hover(xy, width, title(i-1))
+			xy = []float64{x, y}
+		}
+	}
+}
+
+// title names the map by what its colors show
+func (sc *scene) title() string {
+	if sc.legend != nil {
+		return sc.legend.Title
+	}
+	return "gpxrainbow"
+}
+
+// labeler formats the values of the points the way the legend does, without a
+// legend they're the track number
+func (sc *scene) labeler() func(float64) string {
+	if sc.legend != nil {
+		return sc.legend.Label
+	}
+	return func(v float64) string {
+		return fmt.Sprintf("track %.0f", v)
+	}
+}
@@ -0,0 +1,118 @@
+package path
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/golang/geo/s2"
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/meekmichael/gpxrainbow/canvas"
+	"github.com/meekmichael/gpxrainbow/colorpath"
+	"github.com/meekmichael/gpxrainbow/config"
+	"github.com/meekmichael/gpxrainbow/tile"
+	"github.com/meekmichael/gpxrainbow/track"
+	"github.com/stretchr/testify/assert"
+)
+
+type hoverDoc struct {
+	Polylines []struct {
+		Points string `xml:"points,attr"`
+		Width  string `xml:"stroke-width,attr"`
+		Title  string `xml:"title"`
+	} `xml:"polyline"`
+}
+
+// hovers are the polylines of an SVG document with a tooltip
+func hovers(t *testing.T, doc []byte) hoverDoc {
+	var svg hoverDoc
+	assert.NoError(t, xml.Unmarshal(doc, &svg))
+	hovered := svg.Polylines[:0]
+	for _, p := range svg.Polylines {
+		if p.Title != "" {
+			hovered = append(hovered, p)
+		}
+	}
+	svg.Polylines = hovered
+	return svg
+}
+
+func TestHoverPath(t *testing.T) {
+	red, blue := colorful.Color{R: 1}, colorful.Color{B: 1}
+	cp := colorpath.NewColorPath(5)
+	cp.Name = "ride & run.gpx"
+	cp.Positions = []colorpath.Point{
+		{LatLng: s2.LatLngFromDegrees(0, 0), Color: red, Value: 1},
+		{LatLng: s2.LatLngFromDegrees(0, 1), Color: blue, Value: 1.2},
+		{LatLng: s2.LatLngFromDegrees(0, 2), Color: blue, Value: math.NaN()},
+		{LatLng: s2.LatLngFromDegrees(0, 3), Color: blue, Value: 3},
+	}
+	project := func(ll s2.LatLng) (float64, float64) {
+		return 10 * ll.Lng.Degrees(), 0
+	}
+	label := func(v float64) string {
+		return fmt.Sprintf("%.0f mph", v)
+	}
+
+	svg := canvas.NewSVG(100, 100)
+	hoverPath(svg, cp, project, label)
+	buf := bytes.Buffer{}
+	_, err := svg.WriteTo(&buf)
+	assert.NoError(t, err)
+	doc := hovers(t, buf.Bytes())
+	if !assert.Len(t, doc.Polylines, 2) {
+		return
+	}
+	// the lines with the same label go together, whatever their color
+	assert.Equal(t, "0,0 10,0 20,0", doc.Polylines[0].Points)
+	assert.Equal(t, "1 mph\nride & run.gpx", doc.Polylines[0].Title)
+	assert.Equal(t, "13", doc.Polylines[0].Width)
+	assert.Equal(t, "20,0 30,0", doc.Polylines[1].Points)
+	assert.Equal(t, "ride & run.gpx", doc.Polylines[1].Title)
+
+	cp.Dash = []float64{8, 6}
+	svg = canvas.NewSVG(100, 100)
+	hoverPath(svg, cp, project, label)
+	buf.Reset()
+	_, err = svg.WriteTo(&buf)
+	assert.NoError(t, err)
+	doc = hovers(t, buf.Bytes())
+	if assert.Len(t, doc.Polylines, 1) {
+		assert.Equal(t, "0,0 10,0 20,0 30,0", doc.Polylines[0].Points)
+		assert.Equal(t, "planned route\nride & run.gpx", doc.Polylines[0].Title)
+	}
+}
+
+// TestRenderHTML checks the page is the map with tooltips over the tracks and
+// no scripts
+func TestRenderHTML(t *testing.T) {
+	opts := config.DefaultOptions()
+	opts.TileProvider = tile.NONE
+	opts.Mode = config.MODE_ELEVATION
+	opts.Width, opts.Height = 500, 400
+	r, err := NewRenderer(opts)
+	if !assert.NoError(t, err) {
+		return
+	}
+	buf := bytes.Buffer{}
+	assert.NoError(t, r.RenderHTML([]track.Source{track.ReaderSource("a.gpx", strings.NewReader(testGPX))}, &buf))
+	page := buf.String()
+	assert.True(t, strings.HasPrefix(page, "<!DOCTYPE html>"))
+	assert.Contains(t, page, "<title>elevation (meters)</title>")
+	assert.NotContains(t, page, "<script")
+	assert.NotContains(t, page, "<?xml")
+
+	start, end := strings.Index(page, "<svg"), strings.Index(page, "</svg>")
+	if !assert.True(t, start >= 0 && end > start) {
+		return
+	}
+	doc := hovers(t, []byte(page[start:end+len("</svg>")]))
+	if !assert.Len(t, doc.Polylines, 2) {
+		return
+	}
+	assert.Equal(t, "250\na.gpx", doc.Polylines[0].Title)
+	assert.Equal(t, "280\na.gpx", doc.Polylines[1].Title)
+}
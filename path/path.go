@@ -3,68 +3,302 @@ package path
 import (
 	"errors"
 	"fmt"
+	"image"
+	"io"
 	"math"
-	"strings"
+	"os"
+	"runtime"
+	"sort"
+	"time"
 
 	sm "github.com/flopp/go-staticmaps"
 	"github.com/fogleman/gg"
 	"github.com/golang/geo/s2"
 	"github.com/lucasb-eyer/go-colorful"
+	"github.com/meekmichael/gpxrainbow/canvas"
 	"github.com/meekmichael/gpxrainbow/colorpath"
 	"github.com/meekmichael/gpxrainbow/config"
+	"github.com/meekmichael/gpxrainbow/filter"
 	"github.com/meekmichael/gpxrainbow/legend"
+	"github.com/meekmichael/gpxrainbow/marker"
 	"github.com/meekmichael/gpxrainbow/pattern"
 	"github.com/meekmichael/gpxrainbow/positionregistry"
 	"github.com/meekmichael/gpxrainbow/tile"
+	"github.com/meekmichael/gpxrainbow/track"
 	"github.com/tkrajina/gpxgo/gpx"
 	"github.com/urfave/cli/v2"
 )
 
+// waypointSize is the size of waypoint pins, in pixels
+const waypointSize = 16
+
+// plannedColor is the color of routes drawn as planned
+var plannedColor = colorful.Color{R: 0.2, G: 0.2, B: 0.2}
+
 // Run is the main method for this project
 func Run(c *cli.Context) error {
-	ctx := sm.NewContext()
 	mConf, err := config.NewConfig(c)
 	if err != nil {
 		return err
 	}
+	sources, err := track.Expand(c.Args().Slice(), os.Stdin)
+	if err != nil {
+		return err
+	}
+	r := &Renderer{Config: mConf, Log: os.Stdout}
+	switch {
+	case config.FrameSequence(mConf.OutputFile):
+		err = saveFrames(r, sources, mConf.OutputFile)
+	case mConf.Format == config.FORMAT_TILES:
+		err = saveTiles(r, sources, mConf.OutputFile)
+	case mConf.Format == config.FORMAT_PNG || mConf.Format == config.FORMAT_JPG:
+		err = saveImage(r, sources, mConf.OutputFile)
+	default:
+		render := map[string]func([]track.Source, io.Writer) error{
+			config.FORMAT_APNG:    r.RenderAPNG,
+			config.FORMAT_GEOJSON: r.RenderGeoJSON,
+			config.FORMAT_GIF:     r.RenderGIF,
+			config.FORMAT_HTML:    r.RenderHTML,
+			config.FORMAT_KML:     r.RenderKML,
+			config.FORMAT_PDF:     r.RenderPDF,
+			config.FORMAT_SVG:     r.RenderSVG,
+		}[mConf.Format]
+		err = writeFile(mConf.OutputFile, func(w io.Writer) error {
+			return render(sources, w)
+		})
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Saved as %s\n", mConf.OutputFile)
+	return nil
+}
+
+// saveImage renders the map and saves it as a PNG or JPEG, with a world file
+// if the config asks for one
+func saveImage(r *Renderer, sources []track.Source, filename string) error {
+	var img image.Image
+	var wf WorldFile
+	var err error
+	if r.Config.WorldFile {
+		img, wf, err = r.RenderGeo(sources)
+	} else {
+		img, err = r.Render(sources)
+	}
+	if err != nil {
+		return err
+	}
+	if r.Config.Format == config.FORMAT_PNG {
+		err = gg.SavePNG(filename, img)
+	} else {
+		err = gg.SaveJPG(filename, img, 85)
+	}
+	if err != nil || !r.Config.WorldFile {
+		return err
+	}
+	return wf.Save(filename)
+}
+
+// writeFile creates a file and writes it with write, the file is only left
+// behind if write succeeds
+func writeFile(filename string, write func(w io.Writer) error) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		os.Remove(filename)
+		return err
+	}
+	return f.Close()
+}
+
+// Renderer draws tracks on a map image.  It is what the command line uses, and
+// the way to use gpxrainbow from other Go programs.
+type Renderer struct {
+	Config config.MapConfig
+	// Log gets progress messages, nil for none
+	Log io.Writer
+}
+
+// NewRenderer validates opts and builds a Renderer that doesn't log
+func NewRenderer(opts config.Options) (*Renderer, error) {
+	conf, err := config.New(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Renderer{Config: conf}, nil
+}
+
+// RenderReaders is Render for GPX documents that aren't files
+func (r *Renderer) RenderReaders(readers ...io.Reader) (image.Image, error) {
+	sources := []track.Source{}
+	for i, rd := range readers {
+		sources = append(sources, track.ReaderSource(fmt.Sprintf("input %d", i+1), rd))
+	}
+	return r.Render(sources)
+}
+
+func (r *Renderer) logf(format string, a ...interface{}) {
+	if r.Log != nil {
+		fmt.Fprintf(r.Log, format, a...)
+	}
+}
+
+// renderMap renders the scene's context, the basemap with objects, which must
+// be the objects in the context.  Without a basemap no tiles are fetched, the
+// objects are drawn on a transparent image where go-staticmaps would put them.
+func (r *Renderer) renderMap(sc *scene, objects []sm.MapObject) (image.Image, error) {
+	if r.Config.Basemap() {
+		return sc.ctx.Render()
+	}
+	v, err := r.fixView(sc)
+	if err != nil {
+		return nil, err
+	}
+	img := image.NewRGBA(image.Rect(0, 0, r.Config.ImageWidth, r.Config.ImageHeight))
+	c := canvas.NewGG(gg.NewContextForRGBA(img))
+	for _, obj := range objects {
+		if d, ok := obj.(canvas.Drawer); ok {
+			d.DrawCanvas(c, v.project)
+		}
+	}
+	return img, nil
+}
+
+// scene is everything to draw on a map
+type scene struct {
+	ctx     *sm.Context
+	objects []sm.MapObject
+	// tracks are the colored paths of the tracks, also in objects
+	tracks []*colorpath.ColorPath
+	// legend is nil for modes without one
+	legend *legend.Options
+}
+
+func (sc *scene) add(obj sm.MapObject) {
+	sc.ctx.AddObject(obj)
+	sc.objects = append(sc.objects, obj)
+}
+
+// Render reads every source and draws their tracks on a map with a legend
+func (r *Renderer) Render(sources []track.Source) (image.Image, error) {
+	sc, err := r.scene(sources)
+	if err != nil {
+		return nil, err
+	}
+	img, err := r.renderMap(sc, sc.objects)
+	if err != nil {
+		return nil, err
+	}
+	if sc.legend != nil {
+		return legend.Render(*sc.legend, img)
+	}
+	return img, nil
+}
+
+// scene reads every source and works out the colored paths and legend
+func (r *Renderer) scene(sources []track.Source) (*scene, error) {
+	mConf := r.Config
+	ctx := sm.NewContext()
 	ctx.SetSize(mConf.ImageWidth, mConf.ImageHeight)
 	ctx.SetTileProvider(tile.ProviderByName(mConf.TileProvider))
+	sc := &scene{ctx: ctx}
 
-	gpxFiles := c.Args().Slice()
-
-	if len(gpxFiles) == 0 {
-		return errors.New("no file(s) specified")
+	if len(sources) == 0 {
+		return nil, errors.New("no file(s) specified")
 	}
-	if mConf.Mode != config.MODE_PROXIMITY {
-		pathData, err := maxSpeedAndElev(gpxFiles)
-		if err != nil {
-			return err
+	r.logf("Processing %d files\n", len(sources))
+	files, err := track.LoadAll(sources, runtime.NumCPU())
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if mConf.Routes == config.ROUTES_TRACK {
+			f.Tracks = append(f.Tracks, f.Routes...)
+		}
+		if stats := filter.File(mConf.Filter, f); stats.Total() > 0 {
+			r.logf("%s: %s\n", f.Name, stats)
 		}
+	}
+
+	clippedMin, clippedMax := false, false
+	if mConf.Mode != config.MODE_PROXIMITY && mConf.Mode != config.MODE_OVERLAP {
+		pathData := maxSpeedAndElev(files, mConf.Mode, float64(mConf.GradeWindow))
 		mConf.MinElevation = pathData.MinElevation
 		mConf.MaxElevation = pathData.MaxElevation
 		mConf.MaxSpeed = pathData.MaxSpeed
+		mConf.MaxGrade = pathData.MaxGrade
+		mConf.MinPace = pathData.MinPace
+		mConf.MaxPace = pathData.MaxPace
+		mConf.MinHeartRate = pathData.MinHeartRate
+		mConf.MaxHeartRate = pathData.MaxHeartRate
+		mConf.MinCadence = pathData.MinCadence
+		mConf.MaxCadence = pathData.MaxCadence
+		mConf.MinPower = pathData.MinPower
+		mConf.MaxPower = pathData.MaxPower
+		mConf.MinStart = pathData.MinStart
+		mConf.MaxStart = pathData.MaxStart
+		if mConf.Mode == config.MODE_HEARTRATE && mConf.MaxHeartRate < mConf.MinHeartRate {
+			return nil, errors.New("no heart rate data found in any of the files")
+		}
+		if mConf.Mode == config.MODE_CADENCE && mConf.MaxCadence < mConf.MinCadence {
+			return nil, errors.New("no cadence data found in any of the files")
+		}
+		if mConf.Mode == config.MODE_POWER && mConf.MaxPower < mConf.MinPower {
+			return nil, errors.New("no power data found in any of the files")
+		}
+		if mConf.Mode == config.MODE_GRADE && mConf.MaxGrade == 0 {
+			return nil, errors.New("no elevation changes found in any of the files")
+		}
+		if mConf.Mode == config.MODE_DATE && mConf.MinStart.IsZero() {
+			return nil, errors.New("no timestamps found in any of the files")
+		}
+		// an empty scale is only an error when --min, --max or --scale_clip
+		// emptied it, data that doesn't vary draws as it always has
+		scaled := mConf.ScaleMin.NotNull() || mConf.ScaleMax.NotNull() || mConf.ClipLow > 0 || mConf.ClipHigh < 100
+		varied := false
+		if min, max := scaleBounds(&mConf); min != nil {
+			varied = *max > *min
+		}
+		clippedMin, clippedMax = applyScale(&mConf, pathData.Values)
+		if mConf.Mode == config.MODE_PACE && mConf.MaxPace <= mConf.MinPace {
+			return nil, errors.New("no movement faster than slowest_pace found in any of the files")
+		}
+		if min, max := scaleBounds(&mConf); min != nil && scaled && varied && *max <= *min {
+			return nil, errors.New("the color scale is empty, check --min, --max and --scale_clip")
+		}
 	}
 
 	paths := []*colorpath.ColorPath{}
-	fmt.Printf("Processing %d GPX files\n", len(gpxFiles))
 	posRegistry := positionregistry.PositionRegistry{
-		MaxColors: uint16(len(gpxFiles)),
+		MaxColors: uint16(len(files)),
+	}
+	for _, f := range files {
+		paths = append(paths, gpxToColorPath(mConf, f, &posRegistry)...)
 	}
-	for _, gpxFile := range gpxFiles {
-		newPaths, err := gpxToColorPath(mConf, gpxFile, &posRegistry)
-		if err != nil {
-			return err
+	if mConf.Mode == config.MODE_OVERLAP {
+		colorByOverlap(mConf, paths, &posRegistry)
+	}
+	if mConf.Routes == config.ROUTES_PLANNED {
+		// under the tracks, so the dashes show where the tracks left the plan
+		for _, p := range plannedPaths(mConf, files) {
+			sc.add(p)
 		}
-		paths = append(paths, newPaths...)
 	}
 	for _, p := range paths {
-		ctx.AddObject(p)
+		sc.add(p)
 	}
-	img, err := ctx.Render()
-
-	if err != nil {
-		return err
+	sc.tracks = paths
+	if !mConf.NoWaypoints {
+		for _, f := range files {
+			for _, wpt := range f.Waypoints {
+				sc.add(marker.NewLabeled(s2.LatLngFromDegrees(wpt.Latitude, wpt.Longitude), wpt.Name, waypointSize))
+			}
+		}
 	}
+
 	legendOpts := legend.Options{
 		GradientTable: pattern.GetGradientTable(),
 	}
@@ -75,52 +309,91 @@ func Run(c *cli.Context) error {
 		legendOpts.FormatString = "%2.0f"
 		legendOpts.Steps = posRegistry.Tracks
 		legendOpts.Title = "count"
+	case config.MODE_OVERLAP:
+		legendOpts.MinVal = 0
+		legendOpts.MaxVal = float64(posRegistry.MaxColors)
+		legendOpts.FormatString = "%2.0f"
+		legendOpts.Steps = int(posRegistry.MaxColors) + 1
+		legendOpts.Title = "other tracks"
 	case config.MODE_ELEVATION:
 		legendOpts.Steps = 250
+		legendOpts.MinVal = mConf.MinElevation * mConf.DisplayScale()
+		legendOpts.MaxVal = mConf.MaxElevation * mConf.DisplayScale()
 		if mConf.Units == "us" {
-			legendOpts.MinVal = mConf.MinElevation * 3.2808399
-			legendOpts.MaxVal = mConf.MaxElevation * 3.2808399
 			legendOpts.Title = "elevation (ft)"
 		} else {
-			legendOpts.MinVal = mConf.MinElevation
-			legendOpts.MaxVal = mConf.MaxElevation
 			legendOpts.Title = "elevation (meters)"
 		}
 		legendOpts.FormatString = "%2.0f"
 	case config.MODE_SPEED:
-		legendOpts.MinVal = 0
+		legendOpts.MinVal = mConf.MinSpeed * mConf.DisplayScale()
+		legendOpts.MaxVal = mConf.MaxSpeed * mConf.DisplayScale()
 		if mConf.Units == "us" {
-			legendOpts.MaxVal = mConf.MaxSpeed * 2.236936 // meters/s -> mph\
 			legendOpts.Title = "Speed (mph)"
 		} else {
-			legendOpts.MaxVal = mConf.MaxSpeed * 3.6 // meters/s -> kph
 			legendOpts.Title = "speed (kph)"
 		}
 		legendOpts.Steps = 250
 
 		legendOpts.FormatString = "%2.1f"
+	case config.MODE_HEARTRATE:
+		legendOpts.MinVal = mConf.MinHeartRate
+		legendOpts.MaxVal = mConf.MaxHeartRate
+		legendOpts.Steps = 250
+		legendOpts.Title = "heart rate (bpm)"
+		legendOpts.FormatString = "%2.0f"
+	case config.MODE_CADENCE:
+		legendOpts.MinVal = mConf.MinCadence
+		legendOpts.MaxVal = mConf.MaxCadence
+		legendOpts.Steps = 250
+		legendOpts.Title = "cadence (rpm)"
+		legendOpts.FormatString = "%2.0f"
+	case config.MODE_POWER:
+		legendOpts.Steps = 250
+		legendOpts.MinVal = mConf.MinPower * mConf.DisplayScale()
+		legendOpts.MaxVal = mConf.MaxPower * mConf.DisplayScale()
+		if mConf.FTP > 0 {
+			legendOpts.Title = "power (% of FTP)"
+		} else {
+			legendOpts.Title = "power (watts)"
+		}
+		legendOpts.FormatString = "%2.0f"
+	case config.MODE_DATE:
+		legendOpts.MinVal = float64(mConf.MinStart.Unix())
+		legendOpts.MaxVal = float64(mConf.MaxStart.Unix())
+		legendOpts.Steps = 250
+		legendOpts.Title = "date"
+		legendOpts.LabelFormatter = dateLabel(mConf.MinStart, mConf.MaxStart)
+	case config.MODE_GRADE:
+		legendOpts.GradientTable = pattern.GetDivergingTable()
+		legendOpts.MinVal = -mConf.MaxGrade
+		legendOpts.MaxVal = mConf.MaxGrade
+		legendOpts.Steps = 250
+		legendOpts.Title = "grade (%)"
+		legendOpts.FormatString = "%+2.0f"
+	case config.MODE_TIMEOFDAY:
+		legendOpts.GradientTable = pattern.GetCyclicTable()
+		legendOpts.MinVal = 0
+		legendOpts.MaxVal = 24
+		legendOpts.Steps = 250
+		legendOpts.Title = "time of day"
+		legendOpts.FormatString = "%02.0f:00"
+	case config.MODE_PACE:
+		// slowest on the cool end, fastest on the warm end like speed mode
+		legendOpts.MinVal = mConf.MaxPace
+		legendOpts.MaxVal = mConf.MinPace
+		legendOpts.Steps = 250
+		legendOpts.Title = "pace"
+		legendOpts.LabelFormatter = paceLabel(mConf.Units)
+		clippedMin, clippedMax = clippedMax, clippedMin
 	}
+	legendOpts.ClippedMin = clippedMin
+	legendOpts.ClippedMax = clippedMax
 
 	if mConf.Mode != config.MODE_INPUT {
-		img, err = legend.Render(legendOpts, img)
+		sc.legend = &legendOpts
 	}
-	if err != nil {
-		return err
-	}
-
-	if strings.HasSuffix(mConf.OutputFile, "png") || strings.HasSuffix(mConf.OutputFile, "PNG") {
-		if err := gg.SavePNG(mConf.OutputFile, img); err != nil {
-			return err
-		}
-	} else {
-		if err := gg.SaveJPG(mConf.OutputFile, img, 85); err != nil {
-			return err
-		}
-	}
-	if err == nil {
-		fmt.Printf("Saved as %s\n", mConf.OutputFile)
-	}
-	return err
+	return sc, nil
 }
 
 // AggregatePathData is aggregate information about all paths togethe
@@ -128,24 +401,112 @@ type AggregatePathData struct {
 	MinElevation float64
 	MaxElevation float64
 	MaxSpeed     float64
+	MaxGrade     float64
+	MinPace      float64
+	MaxPace      float64
+	MinHeartRate float64
+	MaxHeartRate float64
+	MinCadence   float64
+	MaxCadence   float64
+	MinPower     float64
+	MaxPower     float64
+	MinStart     time.Time
+	MaxStart     time.Time
+
+	// every value of the current mode's metric, for percentile scaling
+	Values []float64
 }
 
-func maxSpeedAndElev(filenames []string) (AggregatePathData, error) {
+// dateLabel picks a legend label format that fits for the span of dates shown
+func dateLabel(min, max time.Time) func(float64) string {
+	layout := "Jan 2"
+	if max.Sub(min) > 365*24*time.Hour {
+		layout = "Jan 2006"
+	} else if min.Year() != max.Year() {
+		layout = "1/2/06"
+	}
+	return func(v float64) string {
+		return time.Unix(int64(v), 0).Format(layout)
+	}
+}
+
+// paceLabel formats a pace in seconds per meter as "m:ss/km" or "m:ss/mi", no
+// space so five of them fit across the legend
+func paceLabel(units string) func(float64) string {
+	suffix := "/km"
+	if units == "us" {
+		suffix = "/mi"
+	}
+	return func(v float64) string {
+		sec := int(math.Round(v * config.UnitDistance(units)))
+		return fmt.Sprintf("%d:%02d%s", sec/60, sec%60, suffix)
+	}
+}
+
+// timeOfDay returns how far through the day t is, from 0 at midnight to 1
+func timeOfDay(t time.Time) float64 {
+	h, m, s := t.Clock()
+	return float64(h*3600+m*60+s) / (24 * 3600)
+}
+
+// updateRange widens [min, max] to include v if v is set
+func updateRange(v gpx.NullableFloat64, min, max *float64) {
+	if v.NotNull() {
+		*min = math.Min(*min, v.Value())
+		*max = math.Max(*max, v.Value())
+	}
+}
+
+// maxSpeedAndElev works out the range of every value a path can be colored by,
+// across all files
+func maxSpeedAndElev(files []*track.File, mode string, gradeWindow float64) AggregatePathData {
 	minElev := math.Inf(1)
 	maxElev := 0.0
 	maxSpeed := 0.0
-	for _, gpxFile := range filenames {
-		gpxdata, err := gpx.ParseFile(gpxFile)
-		if err != nil {
-			return AggregatePathData{}, fmt.Errorf("likely invalid GPX file %s, error: %v", gpxFile, err)
+	maxGrade := 0.0
+	minPace, maxPace := math.Inf(1), 0.0
+	minHR, maxHR := math.Inf(1), math.Inf(-1)
+	minCad, maxCad := math.Inf(1), math.Inf(-1)
+	minPwr, maxPwr := math.Inf(1), math.Inf(-1)
+	minStart, maxStart := time.Time{}, time.Time{}
+	modeValues := []float64{}
+	collect := func(m string, v float64) {
+		if m == mode {
+			modeValues = append(modeValues, v)
+		}
+	}
+	collectNullable := func(m string, v gpx.NullableFloat64) {
+		if v.NotNull() {
+			collect(m, v.Value())
 		}
-		for _, trk := range gpxdata.Tracks {
+	}
+	for _, f := range files {
+		for _, trk := range f.Tracks {
+			start := trk.Start()
+			if !start.IsZero() {
+				if minStart.IsZero() || start.Before(minStart) {
+					minStart = start
+				}
+				if start.After(maxStart) {
+					maxStart = start
+				}
+			}
 			for _, seg := range trk.Segments {
-				if err != nil {
-					return AggregatePathData{}, err
+				for _, g := range segmentGrades(seg.Points, gradeWindow) {
+					if g.NotNull() {
+						maxGrade = math.Max(maxGrade, math.Abs(g.Value()))
+					}
+					collectNullable(config.MODE_GRADE, g)
 				}
-				for i := range seg.Points {
-					elev := seg.Points[i].GetElevation()
+				for i, pt := range seg.Points {
+					updateRange(pt.HeartRate, &minHR, &maxHR)
+					updateRange(pt.Cadence, &minCad, &maxCad)
+					updateRange(pt.Power, &minPwr, &maxPwr)
+					collectNullable(config.MODE_HEARTRATE, pt.HeartRate)
+					collectNullable(config.MODE_CADENCE, pt.Cadence)
+					collectNullable(config.MODE_POWER, pt.Power)
+					elev := pt.Elevation
+					collectNullable(config.MODE_ELEVATION, elev)
 					if elev.NotNull() {
 						if elev.Value() > maxElev {
 							maxElev = elev.Value()
@@ -157,10 +518,20 @@ func maxSpeedAndElev(filenames []string) (AggregatePathData, error) {
 					if i == 0 {
 						continue
 					}
-					spd := seg.Points[i].SpeedBetween(&seg.Points[i-1], true)
-					if spd > maxSpeed && spd != math.Inf(1) {
+					// untimed points have no speed, rather than standing still
+					spd, ok := seg.Points[i].SpeedBetween(&seg.Points[i-1])
+					if !ok {
+						continue
+					}
+					if spd > maxSpeed {
 						maxSpeed = spd
 					}
+					collect(config.MODE_SPEED, spd)
+					if spd > 0 {
+						minPace = math.Min(minPace, 1/spd)
+						maxPace = math.Max(maxPace, 1/spd)
+						collect(config.MODE_PACE, 1/spd)
+					}
 				}
 			}
 		}
@@ -169,48 +540,209 @@ func maxSpeedAndElev(filenames []string) (AggregatePathData, error) {
 		MinElevation: minElev,
 		MaxElevation: maxElev,
 		MaxSpeed:     maxSpeed,
-	}, nil
+		MaxGrade:     maxGrade,
+		MinPace:      minPace,
+		MaxPace:      maxPace,
+		MinHeartRate: minHR,
+		MaxHeartRate: maxHR,
+		MinCadence:   minCad,
+		MaxCadence:   maxCad,
+		MinPower:     minPwr,
+		MaxPower:     maxPwr,
+		MinStart:     minStart,
+		MaxStart:     maxStart,
+		Values:       modeValues,
+	}
 }
 
-// gpxToColorPath iterates through a single GPX file and builds a ColorPath object
-// to be later drawn onto a map
-func gpxToColorPath(conf config.MapConfig, filename string, posRegistry *positionregistry.PositionRegistry) ([]*colorpath.ColorPath, error) {
-	gpxdata, err := gpx.ParseFile(filename)
-	if err != nil {
-		return []*colorpath.ColorPath{}, err
+// colorByOverlap is the second pass of overlap mode.  Every path is registered
+// first, then each point is colored by how many *other* tracks come within
+// ProximityDistance of it, so the result doesn't depend on the order the files
+// were given in.  Paths are also sorted so that overlapping paths are drawn in
+// the same order no matter how the files were ordered.
+func colorByOverlap(conf config.MapConfig, paths []*colorpath.ColorPath, posRegistry *positionregistry.PositionRegistry) {
+	sort.SliceStable(paths, func(i, j int) bool {
+		return pathLess(paths[i], paths[j])
+	})
+	// registered by track, so the segments of one track don't count each other
+	for _, p := range paths {
+		posRegistry.AddFromColorPath(p, p.Track)
+	}
+	posRegistry.MaxColors = 1
+	if posRegistry.Tracks > 1 {
+		posRegistry.MaxColors = uint16(posRegistry.Tracks - 1)
+	}
+	for _, p := range paths {
+		for j := range p.Positions {
+			countNear := posRegistry.CountNearOthers(p.Positions[j].LatLng, float64(conf.ProximityDistance), p.Track)
+			p.Positions[j].Color = pattern.GetGradientTable().GetInterpolatedColorFor(float64(countNear) / float64(posRegistry.MaxColors))
+			p.Positions[j].Value = float64(countNear)
+		}
+	}
+}
+
+// pathLess orders paths by their content alone: first point, then last point,
+// then length
+func pathLess(a, b *colorpath.ColorPath) bool {
+	if len(a.Positions) == 0 || len(b.Positions) == 0 {
+		return len(a.Positions) < len(b.Positions)
+	}
+	for _, pair := range [][2]s2.LatLng{
+		{a.Positions[0].LatLng, b.Positions[0].LatLng},
+		{a.Positions[len(a.Positions)-1].LatLng, b.Positions[len(b.Positions)-1].LatLng},
+	} {
+		if pair[0].Lat != pair[1].Lat {
+			return pair[0].Lat < pair[1].Lat
+		}
+		if pair[0].Lng != pair[1].Lng {
+			return pair[0].Lng < pair[1].Lng
+		}
+	}
+	return len(a.Positions) < len(b.Positions)
+}
+
+// sensorColor colors a point by a sensor reading from the GPX extensions,
+// falling back to lastColor for points without a reading
+func sensorColor(v gpx.NullableFloat64, min, max float64, lastColor colorful.Color) colorful.Color {
+	if v.Null() || max <= min {
+		return lastColor
+	}
+	return pattern.GetGradientTable().GetInterpolatedColorFor((v.Value()-min)/(max-min)).BlendHcl(lastColor, 0.5)
+}
+
+// sensorValue is a sensor reading in legend units, NaN if there isn't one
+func sensorValue(v gpx.NullableFloat64, scale float64) float64 {
+	if v.Null() {
+		return math.NaN()
+	}
+	return v.Value() * scale
+}
+
+// plannedPaths builds a dashed path for each route segment of every file
+func plannedPaths(conf config.MapConfig, files []*track.File) []*colorpath.ColorPath {
+	paths := []*colorpath.ColorPath{}
+	for _, f := range files {
+		for _, rte := range f.Routes {
+			for _, seg := range rte.Segments {
+				p := colorpath.NewColorPath(float64(conf.LineWidth))
+				p.Dash = []float64{3 * float64(conf.LineWidth), 2 * float64(conf.LineWidth)}
+				p.Name = f.Name
+				for _, pt := range seg.Points {
+					p.Positions = append(p.Positions, colorpath.Point{
+						Color:  plannedColor,
+						LatLng: s2.LatLngFromDegrees(pt.Latitude, pt.Longitude),
+						Value:  math.NaN(),
+					})
+				}
+				paths = append(paths, p)
+			}
+		}
 	}
+	return paths
+}
+
+// gpxToColorPath iterates through a single file and builds a ColorPath object
+// to be later drawn onto a map
+func gpxToColorPath(conf config.MapConfig, f *track.File, posRegistry *positionregistry.PositionRegistry) []*colorpath.ColorPath {
 	paths := []*colorpath.ColorPath{}
 	elevDiff := conf.MaxElevation - conf.MinElevation
-	for _, trk := range gpxdata.Tracks {
-		if conf.Mode == config.MODE_INPUT || conf.Mode == config.MODE_PROXIMITY {
+	for _, trk := range f.Tracks {
+		dateColor := pattern.GetGradientTable().GetInterpolatedColorFor(0)
+		if start := trk.Start(); !start.IsZero() && conf.MaxStart.After(conf.MinStart) {
+			dateColor = pattern.GetGradientTable().GetInterpolatedColorFor(float64(start.Sub(conf.MinStart)) / float64(conf.MaxStart.Sub(conf.MinStart)))
+		}
+		if conf.Mode == config.MODE_INPUT || conf.Mode == config.MODE_PROXIMITY || conf.Mode == config.MODE_OVERLAP {
 			posRegistry.Tracks++
 		}
+		posRegistry.Inputs++
 		for _, seg := range trk.Segments {
 			lastColor := pattern.GetGradientTable().GetInterpolatedColorFor(0)
+			if conf.Mode == config.MODE_GRADE {
+				// flat ground, for a segment that starts without a grade
+				lastColor = pattern.GetDivergingTable().GetInterpolatedColorFor(0.5)
+			}
 			p := colorpath.NewColorPath(float64(conf.LineWidth))
-			spd := float64(0)
+			p.Start = trk.Start()
+			p.Name = f.Name
+			if conf.Mode == config.MODE_OVERLAP {
+				p.Track = posRegistry.Tracks
+			}
+			spd, timed := float64(0), false
+			var grades []gpx.NullableFloat64
+			if conf.Mode == config.MODE_GRADE {
+				grades = segmentGrades(seg.Points, float64(conf.GradeWindow))
+			}
 			for i := 0; i < len(seg.Points); i++ {
 				color := colorful.Color{}
+				value := math.NaN() // in legend units, for showing next to the path
 				if i > 0 {
-					spd = seg.Points[i].SpeedBetween(&seg.Points[i-1], true) // meters/second
+					spd, timed = seg.Points[i].SpeedBetween(&seg.Points[i-1]) // meters/second
 				}
-				elev := seg.Points[i].Elevation
+				pt := seg.Points[i]
+				elev := pt.Elevation
 				switch conf.Mode {
 				case config.MODE_INPUT:
 					color = pattern.GetGradientTable().GetInterpolatedColorFor(float64(posRegistry.Tracks) / float64(posRegistry.MaxColors))
+					value = float64(posRegistry.Inputs)
 				case config.MODE_PROXIMITY:
 					countNear := uint16(0)
 					if posRegistry.Tracks > 1 {
-						countNear = posRegistry.CountNear(s2.LatLngFromDegrees(seg.Points[i].GetLatitude(), seg.Points[i].GetLongitude()), float64(conf.ProximityDistance))
+						countNear = posRegistry.CountNear(s2.LatLngFromDegrees(pt.Latitude, pt.Longitude), float64(conf.ProximityDistance))
 					}
 					color = pattern.GetGradientTable().GetInterpolatedColorFor(float64(countNear) / float64(posRegistry.MaxColors))
+					value = float64(countNear)
 				case config.MODE_SPEED:
+					if i > 0 && !timed {
+						color = lastColor
+						break
+					}
 					// blend factor to make segments blend together better and not be wild colors
 					// especially useful for when there are a lot of points close together in a segment
-					color = pattern.GetGradientTable().GetInterpolatedColorFor(spd/conf.MaxSpeed).BlendHcl(lastColor, 0.7)
+					color = pattern.GetGradientTable().GetInterpolatedColorFor((spd-conf.MinSpeed)/(conf.MaxSpeed-conf.MinSpeed)).BlendHcl(lastColor, 0.7)
+					value = spd * conf.DisplayScale()
+				case config.MODE_PACE:
+					if i > 0 && !timed {
+						color = lastColor
+						break
+					}
+					pace := conf.MaxPace
+					if spd > 0 {
+						pace = math.Min(1/spd, conf.MaxPace)
+					}
+					color = pattern.GetGradientTable().GetInterpolatedColorFor((conf.MaxPace-pace)/(conf.MaxPace-conf.MinPace)).BlendHcl(lastColor, 0.7)
+					value = pace
 				case config.MODE_ELEVATION:
 					if elev.NotNull() {
 						color = pattern.GetGradientTable().GetInterpolatedColorFor((elev.Value()-conf.MinElevation)/elevDiff).BlendHcl(lastColor, 0.5)
+						value = elev.Value() * conf.DisplayScale()
+					} else {
+						color = lastColor
+					}
+				case config.MODE_HEARTRATE:
+					color = sensorColor(pt.HeartRate, conf.MinHeartRate, conf.MaxHeartRate, lastColor)
+					value = sensorValue(pt.HeartRate, 1)
+				case config.MODE_CADENCE:
+					color = sensorColor(pt.Cadence, conf.MinCadence, conf.MaxCadence, lastColor)
+					value = sensorValue(pt.Cadence, 1)
+				case config.MODE_POWER:
+					color = sensorColor(pt.Power, conf.MinPower, conf.MaxPower, lastColor)
+					value = sensorValue(pt.Power, conf.DisplayScale())
+				case config.MODE_DATE:
+					color = dateColor
+					if start := trk.Start(); !start.IsZero() {
+						value = float64(start.Unix())
+					}
+				case config.MODE_TIMEOFDAY:
+					if ts := pt.Timestamp; !ts.IsZero() {
+						color = pattern.GetCyclicTable().GetInterpolatedColorFor(timeOfDay(ts.In(conf.Timezone)))
+						value = 24 * timeOfDay(ts.In(conf.Timezone))
+					} else {
+						color = lastColor
+					}
+				case config.MODE_GRADE:
+					if grades[i].NotNull() {
+						color = pattern.GetDivergingTable().GetInterpolatedColorFor((grades[i].Value()/conf.MaxGrade + 1) / 2)
+						value = grades[i].Value()
 					} else {
 						color = lastColor
 					}
@@ -218,7 +750,9 @@ func gpxToColorPath(conf config.MapConfig, filename string, posRegistry *positio
 				lastColor = color
 				p.Positions = append(p.Positions, colorpath.Point{
 					Color:  color,
-					LatLng: s2.LatLngFromDegrees(seg.Points[i].GetLatitude(), seg.Points[i].GetLongitude()),
+					LatLng: s2.LatLngFromDegrees(pt.Latitude, pt.Longitude),
+					Time:   pt.Timestamp,
+					Value:  value,
 				})
 			}
 			paths = append(paths, p)
@@ -230,5 +764,5 @@ func gpxToColorPath(conf config.MapConfig, filename string, posRegistry *positio
 			}
 		}
 	}
-	return paths, nil
+	return paths
 }
@@ -0,0 +1,296 @@
+package path
+
+import (
+	"image"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	sm "github.com/flopp/go-staticmaps"
+	"github.com/meekmichael/gpxrainbow/colorpath"
+	"github.com/meekmichael/gpxrainbow/config"
+	"github.com/meekmichael/gpxrainbow/pattern"
+	"github.com/meekmichael/gpxrainbow/positionregistry"
+	"github.com/meekmichael/gpxrainbow/tile"
+	"github.com/meekmichael/gpxrainbow/track"
+	"github.com/stretchr/testify/assert"
+)
+
+const testGPX = `<?xml version="1.0"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+<wpt lat="45.005" lon="-93.025"><name>lunch</name></wpt>
+<trk><trkseg>
+<trkpt lat="45.000" lon="-93.000"><ele>250</ele></trkpt>
+<trkpt lat="45.010" lon="-93.020"><ele>280</ele></trkpt>
+<trkpt lat="45.005" lon="-93.030"><ele>265</ele></trkpt>
+</trkseg></trk>
+</gpx>`
+
+// TestRenderer goes from plain options to an image the way a program using the
+// package would
+func TestRenderer(t *testing.T) {
+	opts := config.DefaultOptions()
+	opts.Mode = "Elevation"
+	opts.Width = 10
+	_, err := NewRenderer(opts)
+	assert.Error(t, err)
+
+	opts.TileProvider = tile.NONE
+	opts.Width, opts.Height = 500, 400
+	r, err := NewRenderer(opts)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, config.MODE_ELEVATION, r.Config.Mode)
+	img, err := r.RenderReaders(strings.NewReader(testGPX), strings.NewReader(testGPX))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 500, 400), img.Bounds())
+	colors := map[[3]uint32]bool{}
+	for y := 0; y < 400; y++ {
+		for x := 0; x < 500; x++ {
+			if r, g, b, a := img.At(x, y).RGBA(); a == 0xffff {
+				colors[[3]uint32{r, g, b}] = true
+			}
+		}
+	}
+	// the path goes through more than one color of the scale
+	assert.True(t, len(colors) > 10, "%d colors", len(colors))
+
+	_, err = r.RenderReaders(strings.NewReader("not a track"))
+	assert.Error(t, err)
+}
+
+// TestRenderNoBasemap renders without any tile server, the paths, waypoint and
+// legend on a transparent image
+func TestRenderNoBasemap(t *testing.T) {
+	opts := config.DefaultOptions()
+	opts.TileProvider = tile.NONE
+	opts.Mode = config.MODE_ELEVATION
+	opts.Width, opts.Height = 800, 480
+	r, err := NewRenderer(opts)
+	assert.NoError(t, err)
+	assert.False(t, r.Config.Basemap())
+
+	img, err := r.RenderReaders(strings.NewReader(testGPX))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 800, 480), img.Bounds())
+	opaque, clear := 0, 0
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			switch _, _, _, a := img.At(x, y).RGBA(); a {
+			case 0:
+				clear++
+			case 0xffff:
+				opaque++
+			}
+		}
+	}
+	assert.True(t, clear > b.Dx()*b.Dy()/2, "%d see through pixels", clear)
+	assert.True(t, opaque > 0)
+	// the legend is in the bottom right corner
+	_, _, _, a := img.At(b.Max.X-20, b.Max.Y-60).RGBA()
+	assert.NotZero(t, a)
+	_, _, _, a = img.At(5, 5).RGBA()
+	assert.Zero(t, a)
+
+	// the paths are where they'd be on a basemap
+	sc, err := r.scene([]track.Source{track.ReaderSource("input 1", strings.NewReader(testGPX))})
+	assert.NoError(t, err)
+	v, err := r.fixView(sc)
+	assert.NoError(t, err)
+	cp := sc.tracks[0]
+	x0, y0 := v.project(cp.Positions[0].LatLng)
+	x1, y1 := v.project(cp.Positions[1].LatLng)
+	_, _, _, a = img.At(int((x0+x1)/2), int((y0+y1)/2)).RGBA()
+	assert.Equal(t, uint32(0xffff), a)
+}
+
+// TestRenderFlatScale renders data whose values don't vary, which has an empty
+// color scale without any --min, --max or --scale_clip
+func TestRenderFlatScale(t *testing.T) {
+	untimed := `<gpx version="1.1" xmlns="http://www.topografix.com/GPX/1/1"><trk><trkseg>
+<trkpt lat="45.000" lon="-93.000"></trkpt>
+<trkpt lat="45.010" lon="-93.020"></trkpt>
+</trkseg></trk></gpx>`
+	for _, mode := range []string{config.MODE_SPEED, config.MODE_ELEVATION} {
+		opts := config.DefaultOptions()
+		opts.TileProvider = tile.NONE
+		opts.Mode = mode
+		r, err := NewRenderer(opts)
+		assert.NoError(t, err)
+		_, err = r.RenderReaders(strings.NewReader(untimed))
+		assert.NoError(t, err, mode)
+	}
+
+	// a scale emptied by --min is an error
+	opts := config.DefaultOptions()
+	opts.TileProvider = tile.NONE
+	opts.Mode = config.MODE_ELEVATION
+	opts.Min = "300"
+	r, err := NewRenderer(opts)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = r.RenderReaders(strings.NewReader(testGPX))
+	assert.EqualError(t, err, "the color scale is empty, check --min, --max and --scale_clip")
+}
+
+// TestUntimedSpeed checks points without a time don't count as standing still
+// in the speed scale
+func TestUntimedSpeed(t *testing.T) {
+	start := time.Date(2021, 5, 1, 6, 0, 0, 0, time.UTC)
+	points := []track.Point{
+		{Latitude: 45, Longitude: -93, Timestamp: start},
+		{Latitude: 45.0001, Longitude: -93, Timestamp: start.Add(2 * time.Second)},
+		{Latitude: 45.0002, Longitude: -93},
+		{Latitude: 45.0003, Longitude: -93, Timestamp: start.Add(6 * time.Second)},
+		{Latitude: 45.0004, Longitude: -93, Timestamp: start.Add(6 * time.Second)},
+	}
+	f := &track.File{Tracks: []track.Track{{Segments: []track.Segment{{Points: points}}}}}
+	data := maxSpeedAndElev([]*track.File{f}, config.MODE_SPEED, 50)
+	assert.Len(t, data.Values, 1)
+	assert.InDelta(t, 5.56, data.Values[0], 0.01)
+}
+
+// TestRoutes checks what each --routes choice makes of a GPX route
+func TestRoutes(t *testing.T) {
+	doc := `<gpx version="1.1" xmlns="http://www.topografix.com/GPX/1/1">
+<rte><name>plan</name>
+<rtept lat="45.000" lon="-93.000"></rtept>
+<rtept lat="45.020" lon="-93.010"></rtept>
+<rtept lat="45.030" lon="-93.040"></rtept>
+</rte>
+<trk><trkseg>
+<trkpt lat="45.000" lon="-93.000"><ele>250</ele></trkpt>
+<trkpt lat="45.010" lon="-93.020"><ele>280</ele></trkpt>
+</trkseg></trk>
+</gpx>`
+	for _, tc := range []struct {
+		routes          string
+		tracks, planned int
+	}{
+		{config.ROUTES_PLANNED, 1, 1},
+		{config.ROUTES_TRACK, 2, 0},
+		{config.ROUTES_NONE, 1, 0},
+	} {
+		opts := config.DefaultOptions()
+		opts.TileProvider = tile.NONE
+		opts.Mode = config.MODE_ELEVATION
+		opts.Routes = tc.routes
+		r, err := NewRenderer(opts)
+		if !assert.NoError(t, err) {
+			return
+		}
+		sc, err := r.scene([]track.Source{track.ReaderSource("plan.gpx", strings.NewReader(doc))})
+		if !assert.NoError(t, err, tc.routes) {
+			continue
+		}
+		assert.Len(t, sc.tracks, tc.tracks, tc.routes)
+		planned := []*colorpath.ColorPath{}
+		for _, obj := range sc.objects {
+			if cp, ok := obj.(*colorpath.ColorPath); ok && len(cp.Dash) > 0 {
+				planned = append(planned, cp)
+			}
+		}
+		assert.Len(t, planned, tc.planned, tc.routes)
+		for _, cp := range planned {
+			assert.Len(t, cp.Positions, 3)
+			assert.Equal(t, "plan.gpx", cp.Name)
+			for _, pos := range cp.Positions {
+				assert.Equal(t, plannedColor, pos.Color)
+				assert.True(t, math.IsNaN(pos.Value))
+			}
+			// under the tracks
+			assert.Equal(t, sm.MapObject(cp), sc.objects[0])
+		}
+	}
+}
+
+// TestGradeStartColor checks a segment that starts without a grade is drawn
+// as flat ground, not in the color of the other modes' scale
+func TestGradeStartColor(t *testing.T) {
+	points := []track.Point{{Latitude: 45, Longitude: -93}, {Latitude: 45.001, Longitude: -93}}
+	f := &track.File{Tracks: []track.Track{{Segments: []track.Segment{{Points: points}}}}}
+	conf := config.MapConfig{Mode: config.MODE_GRADE, MaxGrade: 10, GradeWindow: 50, LineWidth: 3}
+	paths := gpxToColorPath(conf, f, &positionregistry.PositionRegistry{MaxColors: 1})
+	if !assert.Len(t, paths, 1) {
+		return
+	}
+	flat := pattern.GetDivergingTable().GetInterpolatedColorFor(0.5)
+	for _, pos := range paths[0].Positions {
+		assert.Equal(t, flat, pos.Color)
+	}
+}
+
+// TestOverlapSegments checks the segments of one track don't count as
+// overlapping each other, only other tracks do
+func TestOverlapSegments(t *testing.T) {
+	paused := `<gpx version="1.1" xmlns="http://www.topografix.com/GPX/1/1"><trk>
+<trkseg><trkpt lat="45.000" lon="-93.000"></trkpt><trkpt lat="45.001" lon="-93.000"></trkpt></trkseg>
+<trkseg><trkpt lat="45.001" lon="-93.000"></trkpt><trkpt lat="45.000" lon="-93.000"></trkpt></trkseg>
+</trk></gpx>`
+	other := `<gpx version="1.1" xmlns="http://www.topografix.com/GPX/1/1"><trk><trkseg>
+<trkpt lat="45.000" lon="-93.000"></trkpt><trkpt lat="45.000" lon="-93.001"></trkpt>
+</trkseg></trk></gpx>`
+	opts := config.DefaultOptions()
+	opts.TileProvider = tile.NONE
+	opts.Mode = config.MODE_OVERLAP
+	r, err := NewRenderer(opts)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	sc, err := r.scene([]track.Source{track.ReaderSource("paused.gpx", strings.NewReader(paused))})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, sc.tracks, 2)
+	for _, cp := range sc.tracks {
+		for _, pos := range cp.Positions {
+			assert.Equal(t, 0.0, pos.Value)
+		}
+	}
+
+	sc, err = r.scene([]track.Source{
+		track.ReaderSource("paused.gpx", strings.NewReader(paused)),
+		track.ReaderSource("other.gpx", strings.NewReader(other)),
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, sc.tracks, 3)
+	for _, cp := range sc.tracks {
+		// where they start the other track is the only one nearby
+		assert.Equal(t, 1.0, cp.Positions[0].Value+cp.Positions[len(cp.Positions)-1].Value, cp.Name)
+	}
+	assert.Equal(t, 1.0, sc.legend.MaxVal)
+}
+
+// TestInputValues checks input mode numbers the tracks in the order they were
+// read, once each however many segments they have
+func TestInputValues(t *testing.T) {
+	segment := func(lat float64) track.Segment {
+		return track.Segment{Points: []track.Point{{Latitude: lat, Longitude: -93}, {Latitude: lat + 0.001, Longitude: -93}}}
+	}
+	files := []*track.File{
+		{Name: "a.gpx", Tracks: []track.Track{{Segments: []track.Segment{segment(45)}}}},
+		{Name: "b.gpx", Tracks: []track.Track{{Segments: []track.Segment{segment(45.01)}}}},
+		{Name: "c.gpx", Tracks: []track.Track{{Segments: []track.Segment{segment(45.02), segment(45.03)}}}},
+	}
+	conf := config.MapConfig{Mode: config.MODE_INPUT, LineWidth: 3}
+	registry := positionregistry.PositionRegistry{MaxColors: uint16(len(files))}
+	paths := []*colorpath.ColorPath{}
+	for _, f := range files {
+		paths = append(paths, gpxToColorPath(conf, f, &registry)...)
+	}
+	if !assert.Len(t, paths, 4) {
+		return
+	}
+	for i, want := range []float64{1, 2, 3, 3} {
+		for _, pos := range paths[i].Positions {
+			assert.Equal(t, want, pos.Value, paths[i].Name)
+		}
+	}
+}
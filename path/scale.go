@@ -0,0 +1,88 @@
+package path
+
+import (
+	"math"
+	"sort"
+
+	"github.com/meekmichael/gpxrainbow/config"
+)
+
+// scaleBounds returns the min and max of the color scale for modes that color
+// by a value, or nils for the modes that don't
+func scaleBounds(conf *config.MapConfig) (*float64, *float64) {
+	switch conf.Mode {
+	case config.MODE_SPEED:
+		return &conf.MinSpeed, &conf.MaxSpeed
+	case config.MODE_PACE:
+		return &conf.MinPace, &conf.MaxPace
+	case config.MODE_ELEVATION:
+		return &conf.MinElevation, &conf.MaxElevation
+	case config.MODE_HEARTRATE:
+		return &conf.MinHeartRate, &conf.MaxHeartRate
+	case config.MODE_CADENCE:
+		return &conf.MinCadence, &conf.MaxCadence
+	case config.MODE_POWER:
+		return &conf.MinPower, &conf.MaxPower
+	}
+	return nil, nil
+}
+
+// percentile returns the p'th percentile (0-100) of sorted values, interpolating
+// between the closest ranks
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(rank-float64(lo))
+}
+
+// applyScale narrows the color scale of the current mode to the configured
+// percentiles and --min/--max, so a single GPS glitch doesn't squash every real
+// value into one end of the scale.  It returns whether any values fall below the
+// low end or above the high end of the scale, for the legend.
+func applyScale(conf *config.MapConfig, values []float64) (bool, bool) {
+	sort.Float64s(values)
+	if len(values) == 0 {
+		return false, false
+	}
+
+	if conf.Mode == config.MODE_GRADE {
+		// grade is centered on 0% so keep it symmetric, either of --min or
+		// --max sets both ends
+		if conf.ClipLow > 0 || conf.ClipHigh < 100 {
+			conf.MaxGrade = math.Max(math.Abs(percentile(values, conf.ClipLow)), math.Abs(percentile(values, conf.ClipHigh)))
+		}
+		if conf.ScaleMin.NotNull() {
+			conf.MaxGrade = math.Abs(conf.ScaleMin.Value())
+		}
+		if conf.ScaleMax.NotNull() {
+			conf.MaxGrade = math.Abs(conf.ScaleMax.Value())
+		}
+		return values[0] < -conf.MaxGrade, values[len(values)-1] > conf.MaxGrade
+	}
+
+	min, max := scaleBounds(conf)
+	if min == nil {
+		return false, false
+	}
+	if conf.ClipLow > 0 {
+		*min = percentile(values, conf.ClipLow)
+	}
+	if conf.ClipHigh < 100 {
+		*max = percentile(values, conf.ClipHigh)
+	}
+	if conf.Mode == config.MODE_PACE {
+		// standing still is an infinitely slow pace
+		*max = math.Min(*max, conf.SlowestPace)
+	}
+	if conf.ScaleMin.NotNull() {
+		*min = conf.ScaleMin.Value()
+	}
+	if conf.ScaleMax.NotNull() {
+		*max = conf.ScaleMax.Value()
+	}
+	return values[0] < *min, values[len(values)-1] > *max
+}
@@ -0,0 +1,54 @@
+package path
+
+import (
+	"testing"
+
+	"github.com/meekmichael/gpxrainbow/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/tkrajina/gpxgo/gpx"
+)
+
+func TestPercentile(t *testing.T) {
+	sorted := []float64{0, 10, 20, 30, 40}
+	assert.Equal(t, 0.0, percentile(sorted, 0))
+	assert.Equal(t, 40.0, percentile(sorted, 100))
+	assert.Equal(t, 20.0, percentile(sorted, 50))
+	assert.Equal(t, 5.0, percentile(sorted, 12.5))
+}
+
+func TestApplyScale(t *testing.T) {
+	values := []float64{}
+	for i := 0; i <= 100; i++ {
+		values = append(values, float64(i))
+	}
+	values = append(values, 10000) // GPS glitch
+
+	conf := config.MapConfig{Mode: config.MODE_SPEED, ClipLow: 0, ClipHigh: 99, MaxSpeed: 10000}
+	clippedMin, clippedMax := applyScale(&conf, values)
+	assert.Equal(t, 0.0, conf.MinSpeed)
+	assert.InDelta(t, 100, conf.MaxSpeed, 0.1)
+	assert.False(t, clippedMin)
+	assert.True(t, clippedMax)
+
+	conf = config.MapConfig{Mode: config.MODE_HEARTRATE, ClipLow: 0, ClipHigh: 100, MinHeartRate: 0, MaxHeartRate: 10000}
+	conf.ScaleMin = *gpx.NewNullableFloat64(20)
+	clippedMin, clippedMax = applyScale(&conf, values)
+	assert.Equal(t, 20.0, conf.MinHeartRate)
+	assert.Equal(t, 10000.0, conf.MaxHeartRate)
+	assert.True(t, clippedMin)
+	assert.False(t, clippedMax)
+
+	conf = config.MapConfig{Mode: config.MODE_GRADE, ClipLow: 0, ClipHigh: 100, MaxGrade: 30}
+	conf.ScaleMax = *gpx.NewNullableFloat64(12)
+	clippedMin, clippedMax = applyScale(&conf, []float64{-30, -5, 0, 8})
+	assert.Equal(t, 12.0, conf.MaxGrade)
+	assert.True(t, clippedMin)
+	assert.False(t, clippedMax)
+
+	conf = config.MapConfig{Mode: config.MODE_GRADE, ClipLow: 0, ClipHigh: 100, MaxGrade: 30}
+	conf.ScaleMin = *gpx.NewNullableFloat64(-4)
+	clippedMin, clippedMax = applyScale(&conf, []float64{-30, -5, 0, 8})
+	assert.Equal(t, 4.0, conf.MaxGrade)
+	assert.True(t, clippedMin)
+	assert.True(t, clippedMax)
+}
@@ -0,0 +1,257 @@
+package path
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+
+	sm "github.com/flopp/go-staticmaps"
+	"github.com/fogleman/gg"
+	"github.com/golang/geo/s2"
+	"github.com/meekmichael/gpxrainbow/colorpath"
+	"github.com/meekmichael/gpxrainbow/track"
+)
+
+// pyramidTileSize is the size of the tiles of a pyramid, the size web maps show
+// them at
+const pyramidTileSize = 256
+
+// tilePadding is drawn around each tile and cut off, as the rasterizer piles
+// up whatever is past the edge of an image on its edge pixels
+const tilePadding = 4
+
+// RenderTiles reads every source and draws the tracks, planned routes and
+// waypoints as transparent overlay tiles for the XYZ scheme web maps use, from
+// zoom level ZoomMin to ZoomMax.  tile is called with each tile that has
+// something on it.  Every tile draws everything that reaches into it, so lines
+// and pins carry on across the edges, and the colors are worked out once for
+// the whole map.  There's no legend on the tiles.
+func (r *Renderer) RenderTiles(sources []track.Source, tile func(z, x, y int, img *image.RGBA) error) error {
+	sc, err := r.scene(sources)
+	if err != nil {
+		return err
+	}
+	for z := r.Config.ZoomMin; z <= r.Config.ZoomMax; z++ {
+		tiles := tileObjects(sc.objects, z)
+		keys := make([][2]int, 0, len(tiles))
+		for k := range tiles {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if keys[i][0] != keys[j][0] {
+				return keys[i][0] < keys[j][0]
+			}
+			return keys[i][1] < keys[j][1]
+		})
+		r.logf("Drawing %d tiles at zoom %d\n", len(keys), z)
+		for _, k := range keys {
+			img, err := drawTile(tiles[k], z, k[0], k[1])
+			if err != nil {
+				return err
+			}
+			if blank(img) {
+				continue
+			}
+			if err := tile(z, k[0], k[1], img); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// saveTiles renders a tile pyramid as dir/z/x/y.png files
+func saveTiles(r *Renderer, sources []track.Source, dir string) error {
+	return r.RenderTiles(sources, func(z, x, y int, img *image.RGBA) error {
+		name := filepath.Join(dir, fmt.Sprint(z), fmt.Sprint(x), fmt.Sprintf("%d.png", y))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return err
+		}
+		return gg.SavePNG(name, img)
+	})
+}
+
+// tileObjects finds the tiles at zoom z that each object reaches into, with
+// the objects for each tile in the order they're drawn
+func tileObjects(objects []sm.MapObject, z int) map[[2]int][]sm.MapObject {
+	tiles := map[[2]int][]sm.MapObject{}
+	for _, obj := range objects {
+		for k := range objectTiles(obj, z) {
+			tiles[k] = append(tiles[k], obj)
+		}
+	}
+	return tiles
+}
+
+// objectTiles are the tiles at zoom z an object draws on, counting its margin
+// for the line width or the size of a pin and its label.  Paths are followed
+// a tile at a time so a long straight line doesn't take in every tile of its
+// bounding box.
+func objectTiles(obj sm.MapObject, z int) map[[2]int]bool {
+	n := 1 << uint(z)
+	left, top, right, bottom := obj.ExtraMarginPixels()
+	tiles := map[[2]int]bool{}
+	add := func(x0, y0, x1, y1 float64) {
+		tx0 := int(math.Max(0, math.Floor((math.Min(x0, x1)-left)/pyramidTileSize)))
+		tx1 := int(math.Min(float64(n-1), math.Floor((math.Max(x0, x1)+right)/pyramidTileSize)))
+		ty0 := int(math.Max(0, math.Floor((math.Min(y0, y1)-top)/pyramidTileSize)))
+		ty1 := int(math.Min(float64(n-1), math.Floor((math.Max(y0, y1)+bottom)/pyramidTileSize)))
+		for tx := tx0; tx <= tx1; tx++ {
+			for ty := ty0; ty <= ty1; ty++ {
+				tiles[[2]int{tx, ty}] = true
+			}
+		}
+	}
+
+	cp, ok := obj.(*colorpath.ColorPath)
+	if !ok {
+		b := obj.Bounds()
+		x0, y0 := worldPixel(b.Lo(), z)
+		x1, y1 := worldPixel(b.Hi(), z)
+		add(x0, y0, x1, y1)
+		return tiles
+	}
+	for i, pos := range cp.Positions {
+		x1, y1 := worldPixel(pos.LatLng, z)
+		if i == 0 {
+			add(x1, y1, x1, y1)
+			continue
+		}
+		x0, y0 := worldPixel(cp.Positions[i-1].LatLng, z)
+		steps := math.Ceil(math.Hypot(x1-x0, y1-y0) / pyramidTileSize)
+		for s := 0.0; s < steps; s++ {
+			add(x0+(x1-x0)*s/steps, y0+(y1-y0)*s/steps, x0+(x1-x0)*(s+1)/steps, y0+(y1-y0)*(s+1)/steps)
+		}
+	}
+	return tiles
+}
+
+// drawTile draws objects on tile x, y at zoom z
+func drawTile(objects []sm.MapObject, z, x, y int) (*image.RGBA, error) {
+	size := pyramidTileSize + 2*tilePadding
+	padded, err := drawArea(objects, z, float64(x*pyramidTileSize-tilePadding), float64(y*pyramidTileSize-tilePadding), size, size)
+	if err != nil {
+		return nil, err
+	}
+	img := image.NewRGBA(image.Rect(0, 0, pyramidTileSize, pyramidTileSize))
+	draw.Draw(img, img.Bounds(), padded, image.Pt(tilePadding, tilePadding), draw.Src)
+	return img, nil
+}
+
+// drawArea draws objects on a transparent image of the world at zoom z, with
+// its top left corner at world pixel x, y.  Each object draws itself with a
+// go-staticmaps transformer centered on the area, paths only the parts of them
+// that reach into it.
+func drawArea(objects []sm.MapObject, z int, x, y float64, w, h int) (*image.RGBA, error) {
+	ctx := sm.NewContext()
+	ctx.SetTileProvider(&sm.TileProvider{TileSize: pyramidTileSize})
+	// as wide as the world, so nothing within half a world of the area is
+	// wrapped around to the other side
+	ctx.SetSize(pyramidTileSize<<uint(z), h)
+	ctx.SetZoom(z)
+	center := pixelLatLng(x+float64(w)/2, y+float64(h)/2, z)
+	ctx.SetCenter(center)
+	trans, err := ctx.Transformer()
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	gc := gg.NewContextForRGBA(img)
+	cx, cy := trans.LatLngToXY(center)
+	gc.Translate(float64(w)/2-cx, float64(h)/2-cy)
+	for _, obj := range objects {
+		cp, ok := obj.(*colorpath.ColorPath)
+		if !ok || len(cp.Dash) > 0 {
+			// a dashed path is drawn whole, so its dashes line up across tiles
+			obj.Draw(gc, trans)
+			continue
+		}
+		m := cp.Weight
+		for _, piece := range clipPath(cp, z, x-m, y-m, x+float64(w)+m, y+float64(h)+m) {
+			piece.Draw(gc, trans)
+		}
+	}
+	return img, nil
+}
+
+// clipPath cuts cp down to the runs of lines that reach into the box from
+// x0, y0 to x1, y1 of the world at zoom z, each run a path of its own, so a
+// long track isn't stroked in full for every tile it crosses
+func clipPath(cp *colorpath.ColorPath, z int, x0, y0, x1, y1 float64) []*colorpath.ColorPath {
+	pieces := []*colorpath.ColorPath{}
+	start := -1
+	px, py := 0.0, 0.0
+	for i, pos := range cp.Positions {
+		x, y := worldPixel(pos.LatLng, z)
+		if i > 0 && lineInBox(px, py, x, y, x0, y0, x1, y1) {
+			if start < 0 {
+				// from an even point, as Draw strokes the lines in pairs
+				start = (i - 1) &^ 1
+			}
+		} else if start >= 0 {
+			piece := *cp
+			piece.Positions = cp.Positions[start:i]
+			pieces = append(pieces, &piece)
+			start = -1
+		}
+		px, py = x, y
+	}
+	if start >= 0 {
+		piece := *cp
+		piece.Positions = cp.Positions[start:]
+		pieces = append(pieces, &piece)
+	}
+	return pieces
+}
+
+// lineInBox is whether the line from ax, ay to bx, by crosses the box from
+// x0, y0 to x1, y1
+func lineInBox(ax, ay, bx, by, x0, y0, x1, y1 float64) bool {
+	if math.Max(ax, bx) < x0 || math.Min(ax, bx) > x1 || math.Max(ay, by) < y0 || math.Min(ay, by) > y1 {
+		return false
+	}
+	// within the line's bounds it misses the box only if every corner of the
+	// box is on the same side of it
+	side := func(x, y float64) float64 {
+		return (bx-ax)*(y-ay) - (by-ay)*(x-ax)
+	}
+	above, below := 0, 0
+	for _, s := range []float64{side(x0, y0), side(x1, y0), side(x0, y1), side(x1, y1)} {
+		if s > 0 {
+			above++
+		} else if s < 0 {
+			below++
+		}
+	}
+	return above < 4 && below < 4
+}
+
+// worldPixel is where ll is on the whole world's map at zoom z, in pixels
+func worldPixel(ll s2.LatLng, z int) (float64, float64) {
+	mx, my := mercator(ll)
+	half := math.Pi * earthRadius
+	scale := pyramidTileSize * math.Exp2(float64(z)) / (2 * half)
+	return (mx + half) * scale, (half - my) * scale
+}
+
+// pixelLatLng is the position of a pixel on the whole world's map at zoom z
+func pixelLatLng(x, y float64, z int) s2.LatLng {
+	size := pyramidTileSize * math.Exp2(float64(z))
+	lat := math.Atan(math.Sinh(math.Pi * (1 - 2*y/size)))
+	return s2.LatLngFromDegrees(lat*180/math.Pi, x/size*360-180)
+}
+
+// blank is whether nothing was drawn on an image
+func blank(img *image.RGBA) bool {
+	for i := 3; i < len(img.Pix); i += 4 {
+		if img.Pix[i] != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,134 @@
+package path
+
+import (
+	"image"
+	"math/rand"
+	"testing"
+
+	sm "github.com/flopp/go-staticmaps"
+	"github.com/golang/geo/s2"
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/meekmichael/gpxrainbow/colorpath"
+	"github.com/meekmichael/gpxrainbow/marker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorldPixel(t *testing.T) {
+	x, y := worldPixel(s2.LatLngFromDegrees(0, 0), 0)
+	assert.InDelta(t, 128, x, 1e-9)
+	assert.InDelta(t, 128, y, 1e-9)
+	x, y = worldPixel(s2.LatLngFromDegrees(45, -93), 14)
+	ll := pixelLatLng(x, y, 14)
+	assert.InDelta(t, 45, ll.Lat.Degrees(), 1e-9)
+	assert.InDelta(t, -93, ll.Lng.Degrees(), 1e-9)
+}
+
+// TestTileSeams checks the tiles put side by side are the same as drawing the
+// whole area at once, so lines and labels carry on across the tile edges
+func TestTileSeams(t *testing.T) {
+	const z = 15
+	// a point near the corner where four tiles meet
+	cx, cy := float64(7876*pyramidTileSize), float64(11720*pyramidTileSize)
+	cp := colorpath.NewColorPath(9)
+	for i, c := range []colorful.Color{{R: 1}, {G: 1}, {B: 1}, {R: 1, G: 1}} {
+		dx, dy := []float64{-200, 30, -40, 220}[i], []float64{-150, -20, 60, 170}[i]
+		cp.Positions = append(cp.Positions, colorpath.Point{LatLng: pixelLatLng(cx+dx, cy+dy, z), Color: c})
+	}
+	wpt := marker.NewLabeled(pixelLatLng(cx-60, cy+5, z), "a waypoint across the edge", waypointSize)
+	objects := []sm.MapObject{cp, wpt}
+
+	whole, err := drawArea(objects, z, cx-pyramidTileSize, cy-pyramidTileSize, 2*pyramidTileSize, 2*pyramidTileSize)
+	assert.NoError(t, err)
+	tiles := tileObjects(objects, z)
+	assert.Len(t, tiles, 4)
+	diff := 0
+	for k, objs := range tiles {
+		x, y := float64(k[0]*pyramidTileSize), float64(k[1]*pyramidTileSize)
+		img, err := drawTile(objs, z, k[0], k[1])
+		assert.NoError(t, err)
+		assert.False(t, blank(img), "tile %v", k)
+		offset := image.Pt(int(x-cx)+pyramidTileSize, int(y-cy)+pyramidTileSize)
+		for py := 0; py < pyramidTileSize; py++ {
+			for px := 0; px < pyramidTileSize; px++ {
+				a := img.RGBAAt(px, py)
+				b := whole.RGBAAt(px+offset.X, py+offset.Y)
+				// anti-aliasing can be a little different, but not missing
+				if absDiff(a.R, b.R) > 8 || absDiff(a.G, b.G) > 8 || absDiff(a.B, b.B) > 8 || absDiff(a.A, b.A) > 8 {
+					diff++
+				}
+			}
+		}
+	}
+	assert.Zero(t, diff)
+}
+
+// TestObjectTiles checks a long straight line only takes in the tiles it
+// crosses
+func TestObjectTiles(t *testing.T) {
+	const z = 10
+	cp := colorpath.NewColorPath(3)
+	cp.Positions = []colorpath.Point{
+		{LatLng: pixelLatLng(1000, 1000, z)},
+		{LatLng: pixelLatLng(1000+20*pyramidTileSize, 1000+20*pyramidTileSize, z)},
+	}
+	tiles := objectTiles(cp, z)
+	assert.True(t, len(tiles) > 20 && len(tiles) < 80, "%d tiles", len(tiles))
+	assert.True(t, tiles[[2]int{3, 3}])
+	assert.True(t, tiles[[2]int{23, 23}])
+	assert.False(t, tiles[[2]int{23, 3}])
+}
+
+// TestClipPath checks a path is cut down to the runs of lines that reach into
+// a box, keeping lines that cross it with both ends outside
+func TestClipPath(t *testing.T) {
+	const z = 10
+	cp := colorpath.NewColorPath(3)
+	cp.Name = "a.gpx"
+	for _, xy := range [][2]float64{{0, 0}, {50, 50}, {150, 150}, {300, 150}, {400, 400}, {150, 300}, {50, 180}, {180, 50}, {400, 0}} {
+		cp.Positions = append(cp.Positions, colorpath.Point{LatLng: pixelLatLng(1000+xy[0], 1000+xy[1], z)})
+	}
+	pieces := clipPath(cp, z, 1100, 1100, 1200, 1200)
+	if !assert.Len(t, pieces, 2) {
+		return
+	}
+	// into the box and out again, from an even point
+	assert.Equal(t, cp.Positions[0:4], pieces[0].Positions)
+	assert.Equal(t, "a.gpx", pieces[0].Name)
+	// across a corner of the box
+	assert.Equal(t, cp.Positions[6:8], pieces[1].Positions)
+
+	assert.True(t, lineInBox(0, 0, 10, 10, 5, 5, 20, 20))
+	assert.True(t, lineInBox(0, 10, 10, 0, 4, 4, 6, 6))
+	assert.False(t, lineInBox(0, 10, 10, 0, 6, 6, 8, 8))
+	assert.False(t, lineInBox(0, 0, 10, 0, 0, 1, 10, 2))
+}
+
+func benchmarkDrawTile(b *testing.B, points int) {
+	const z = 14
+	// a track wandering across a few hundred tiles
+	rnd := rand.New(rand.NewSource(7))
+	cp := colorpath.NewColorPath(3)
+	x, y := float64(3940*pyramidTileSize), float64(5860*pyramidTileSize)
+	for i := 0; i < points; i++ {
+		x, y = x+rnd.Float64()*20-9, y+rnd.Float64()*20-9
+		cp.Positions = append(cp.Positions, colorpath.Point{LatLng: pixelLatLng(x, y, z), Color: colorful.Hsv(float64(i%360), 1, 1)})
+	}
+	tx, ty := int(x)/pyramidTileSize, int(y)/pyramidTileSize
+	objects := []sm.MapObject{cp}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := drawTile(objects, z, tx, ty); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDrawTile_1000(b *testing.B)  { benchmarkDrawTile(b, 1000) }
+func BenchmarkDrawTile_10000(b *testing.B) { benchmarkDrawTile(b, 10000) }
+
+func absDiff(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
@@ -0,0 +1,150 @@
+package path
+
+import (
+	"io"
+	"math"
+
+	sm "github.com/flopp/go-staticmaps"
+	"github.com/golang/geo/s1"
+	"github.com/golang/geo/s2"
+	"github.com/meekmichael/gpxrainbow/canvas"
+	"github.com/meekmichael/gpxrainbow/legend"
+	"github.com/meekmichael/gpxrainbow/tile"
+	"github.com/meekmichael/gpxrainbow/track"
+)
+
+// RenderSVG reads every source and writes the map as an SVG document: the
+// basemap as an embedded raster image with the paths, waypoints and legend as
+// vector elements over it
+func (r *Renderer) RenderSVG(sources []track.Source, w io.Writer) error {
+	sc, err := r.scene(sources)
+	if err != nil {
+		return err
+	}
+	svg := canvas.NewSVG(r.Config.ImageWidth, r.Config.ImageHeight)
+	if _, err := r.drawVector(sc, svg); err != nil {
+		return err
+	}
+	_, err = svg.WriteTo(w)
+	return err
+}
+
+// RenderPDF reads every source and writes the map as a one page PDF at the
+// page size, margins and DPI of the config, which replace its width and height.
+// Like RenderSVG only the basemap is a raster image.
+func (r *Renderer) RenderPDF(sources []track.Source, w io.Writer) error {
+	page := *r
+	page.Config.ImageWidth, page.Config.ImageHeight = r.Config.PageImageSize()
+	sc, err := page.scene(sources)
+	if err != nil {
+		return err
+	}
+	pdf := canvas.NewPDF(page.Config.ImageWidth, page.Config.ImageHeight, float64(r.Config.DPI),
+		r.Config.PageWidth+2*r.Config.PageMargin, r.Config.PageHeight+2*r.Config.PageMargin)
+	if _, err := page.drawVector(sc, pdf); err != nil {
+		return err
+	}
+	_, err = pdf.WriteTo(w)
+	return err
+}
+
+// drawVector draws a scene on a canvas, with only the basemap rendered as an
+// image, if there is one, and returns the view it was drawn at
+func (r *Renderer) drawVector(sc *scene, c canvas.Canvas) (*view, error) {
+	v, err := r.fixView(sc)
+	if err != nil {
+		return nil, err
+	}
+	if r.Config.Basemap() {
+		sc.ctx.ClearObjects()
+		basemap, err := sc.ctx.Render()
+		if err != nil {
+			return nil, err
+		}
+		c.Image(basemap, 0, 0)
+	}
+	for _, obj := range sc.objects {
+		if d, ok := obj.(canvas.Drawer); ok {
+			d.DrawCanvas(c, v.project)
+		}
+	}
+	if sc.legend != nil {
+		legend.Draw(*sc.legend, c)
+	}
+	return v, nil
+}
+
+// view is the part of the world a rendered map shows
+type view struct {
+	zoom     int
+	center   s2.LatLng
+	tileSize int
+	// project is from coordinates to pixels of the rendered image
+	project canvas.Projection
+}
+
+// fixView pins the scene to its view, see fixView
+func (r *Renderer) fixView(sc *scene) (*view, error) {
+	return fixView(sc.ctx, sc.objects, r.Config.ImageWidth, r.Config.ImageHeight, tile.ProviderByName(r.Config.TileProvider).TileSize)
+}
+
+// fixView pins the context to the zoom and center go-staticmaps would pick for
+// the objects, so the basemap can be rendered without them, and returns the
+// view of the rendered image.  go-staticmaps only gives out the projection of
+// the uncropped tiles, so this works out the crop the same way Render does.
+func fixView(ctx *sm.Context, objects []sm.MapObject, width, height, tileSize int) (*view, error) {
+	trans, err := ctx.Transformer()
+	if err != nil {
+		return nil, err
+	}
+	// x is linear in longitude, a tile spans 360 / 2^zoom degrees
+	lngLo := trans.XYToLatLng(0, 0).Lng.Degrees()
+	lngHi := trans.XYToLatLng(float64(tileSize), 0).Lng.Degrees()
+	zoom := int(math.Round(math.Log2(360 / (lngHi - lngLo))))
+
+	// go-staticmaps centers the objects and their pixel margins in the image,
+	// unless they don't fit, then it centers their bounds
+	bounds := s2.EmptyRect()
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, obj := range objects {
+		b := obj.Bounds()
+		bounds = bounds.Union(b)
+		nwX, nwY := trans.LatLngToXY(b.Vertex(3))
+		seX, seY := trans.LatLngToXY(b.Vertex(1))
+		l, t, r, bot := obj.ExtraMarginPixels()
+		minX, maxX = math.Min(minX, nwX-l), math.Max(maxX, seX+r)
+		minY, maxY = math.Min(minY, nwY-t), math.Max(maxY, seY+bot)
+	}
+	center := trans.XYToLatLng((minX+maxX)/2, (minY+maxY)/2)
+	if maxX-minX > float64(width) || maxY-minY > float64(height) {
+		center = mercatorCenter(bounds)
+	}
+
+	ctx.SetZoom(zoom)
+	ctx.SetCenter(center)
+	if trans, err = ctx.Transformer(); err != nil {
+		return nil, err
+	}
+	// the center lands exactly on the middle pixel Render crops around
+	cx, cy := trans.LatLngToXY(center)
+	offsetX, offsetY := cx-float64(width/2), cy-float64(height/2)
+	return &view{
+		zoom:     zoom,
+		center:   center,
+		tileSize: tileSize,
+		project: func(ll s2.LatLng) (float64, float64) {
+			x, y := trans.LatLngToXY(ll)
+			return x - offsetX, y - offsetY
+		},
+	}, nil
+}
+
+// mercatorCenter is the visual center of bounds on a Mercator map
+func mercatorCenter(bounds s2.Rect) s2.LatLng {
+	latLo := bounds.Lo().Lat.Radians()
+	latHi := bounds.Hi().Lat.Radians()
+	yLo := math.Log((1+math.Sin(latLo))/(1-math.Sin(latLo))) / 2
+	yHi := math.Log((1+math.Sin(latHi))/(1-math.Sin(latHi))) / 2
+	return s2.LatLng{Lat: s1.Angle(math.Atan(math.Sinh((yLo + yHi) / 2))), Lng: bounds.Center().Lng}
+}
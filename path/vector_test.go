@@ -0,0 +1,86 @@
+package path
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/png"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sm "github.com/flopp/go-staticmaps"
+	"github.com/golang/geo/s2"
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/meekmichael/gpxrainbow/colorpath"
+	"github.com/meekmichael/gpxrainbow/marker"
+	"github.com/stretchr/testify/assert"
+)
+
+// testTiles serves plain white tiles, so tests don't need the network
+func testTiles() (*sm.TileProvider, func()) {
+	tileImg := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	draw.Draw(tileImg, tileImg.Bounds(), image.White, image.Point{}, draw.Src)
+	buf := bytes.Buffer{}
+	png.Encode(&buf, tileImg)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(buf.Bytes())
+	}))
+	return &sm.TileProvider{
+		Name:        "test",
+		Attribution: "test tiles",
+		TileSize:    256,
+		URLPattern:  server.URL + "/%[1]s/%[2]d/%[3]d/%[4]d.png",
+		Shards:      []string{"a"},
+	}, server.Close
+}
+
+// TestFixView checks that vector objects land on the same pixels as they do
+// when go-staticmaps draws them itself
+func TestFixView(t *testing.T) {
+	provider, closeTiles := testTiles()
+	defer closeTiles()
+	red := colorful.Color{R: 1}
+	for _, size := range [][2]int{{400, 300}, {333, 517}} {
+		cp := colorpath.NewColorPath(5)
+		for _, ll := range [][2]float64{{45, -93}, {45.01, -93.02}, {45.005, -93.03}} {
+			cp.Positions = append(cp.Positions, colorpath.Point{LatLng: s2.LatLngFromDegrees(ll[0], ll[1]), Color: red})
+		}
+		wpt := marker.NewLabeled(s2.LatLngFromDegrees(44.99, -93.035), "a long waypoint name", waypointSize)
+		objects := []sm.MapObject{cp, wpt}
+
+		ctx := sm.NewContext()
+		ctx.SetSize(size[0], size[1])
+		ctx.SetTileProvider(provider)
+		ctx.SetCache(nil)
+		for _, obj := range objects {
+			ctx.AddObject(obj)
+		}
+		img, err := ctx.Render()
+		assert.NoError(t, err)
+
+		v, err := fixView(ctx, objects, size[0], size[1], 256)
+		assert.NoError(t, err)
+		project := v.project
+		for i := 1; i < len(cp.Positions); i++ {
+			x0, y0 := project(cp.Positions[i-1].LatLng)
+			x1, y1 := project(cp.Positions[i].LatLng)
+			r, g, b, _ := img.At(int(math.Round((x0+x1)/2)), int(math.Round((y0+y1)/2))).RGBA()
+			assert.Equal(t, []uint32{0xffff, 0, 0}, []uint32{r, g, b}, "segment %d at %v", i, size)
+		}
+
+		// pinned to the same view, the objects draw in the same place
+		img2, err := ctx.Render()
+		assert.NoError(t, err)
+		diff := 0
+		for y := 0; y < size[1]; y++ {
+			for x := 0; x < size[0]; x++ {
+				if img.At(x, y) != img2.At(x, y) {
+					diff++
+				}
+			}
+		}
+		assert.Less(t, diff, size[0]*size[1]/100)
+	}
+}
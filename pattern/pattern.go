@@ -34,8 +34,36 @@ func GetGradientTable() GradientTable {
 	}
 }
 
+// GetDivergingTable is for values centered on zero, like grade, where the
+// cool half is descending, the warm half climbing and the middle is flat
+func GetDivergingTable() GradientTable {
+	return GradientTable{
+		{MustHex("#001eff"), 0},
+		{MustHex("#2db2ee"), 0.3},
+		{MustHex("#e0e0e0"), 0.5},
+		{MustHex("#deef03"), 0.7},
+		{MustHex("#c92009"), 1},
+	}
+}
+
+// GetCyclicTable is for values that wrap around, like time of day, so both ends
+// are the same color
+func GetCyclicTable() GradientTable {
+	return GradientTable{
+		{MustHex("#001eff"), 0},
+		{MustHex("#2db2ee"), 0.25},
+		{MustHex("#deef03"), 0.5},
+		{MustHex("#c92009"), 0.75},
+		{MustHex("#001eff"), 1},
+	}
+}
+
 // GetInterpolatedColorFor is borrowed from https://github.com/lucasb-eyer/go-colorful
 func (gt GradientTable) GetInterpolatedColorFor(t float64) colorful.Color {
+	// values clipped off the cool end of the scale
+	if t < gt[0].Pos {
+		return gt[0].Col
+	}
 	for i := 0; i < len(gt)-1; i++ {
 		c1 := gt[i]
 		c2 := gt[i+1]
@@ -2,53 +2,67 @@ package positionregistry
 
 import (
 	"math"
-	"sync"
 
 	"github.com/golang/geo/s2"
 	"github.com/meekmichael/gpxrainbow/colorpath"
 )
 
+// earthMeters is the approx circumference of earth divided by 2π, close enough
+// for a toy rainbow map program
+const earthMeters = 40_050_000 / (2 * math.Pi)
+
 // PositionRegistry keeps state for prior locations seen in GPX paths
 type PositionRegistry struct {
 	MaxColors uint16
 	SeenPos   map[int][]s2.LatLng
 	Tracks    int
+	// Inputs counts the tracks read so far once each, to number them by
+	Inputs int
+
+	// spatial index over SeenPos, bucketed by s2 cell at indexLevel
+	index      map[s2.CellID][]indexedPos
+	indexLevel int
+}
+
+// indexedPos is a position in the spatial index along with the track it came from
+type indexedPos struct {
+	ll  s2.LatLng
+	trk int
 }
 
 // CountNear returns the number of previous paths that had one point within _meters_
-// meters of the current position.  This approach, while kind of slow, yields a
-// good result because we don't double count us backtracking over the same
-// point on any one walk, and doesn't count when the points in a segment are less
-// than _meters_ meters apart.
+// meters of the current position.  We don't double count us backtracking over
+// the same point on any one walk, and don't count when the points in a segment
+// are less than _meters_ meters apart.
+//
+// Positions are bucketed into s2 cells at least _meters_ wide, so only the cell
+// containing the position and its immediate neighbors need to be searched.
 func (p *PositionRegistry) CountNear(ll s2.LatLng, meters float64) uint16 {
-	ret := uint16(0)
-	wg := sync.WaitGroup{}
-	retChan := make(chan uint16, len(p.SeenPos))
-	for _, positions := range p.SeenPos {
-		wg.Add(1)
-
-		// for each prior path, concurrently check if we've been close to this spot
-		go func(wg *sync.WaitGroup, ll s2.LatLng, meters float64, positions []s2.LatLng, rChan chan uint16) {
-			defer wg.Done()
-			for _, prevPt := range positions {
-				rad := prevPt.Distance(ll).Radians()         // degrees apart that these two points arex
-				distance := 40_050_000 / (2 * math.Pi) * rad // approx circumference of earth, close enough for a toy rainbow map program
-				if distance < meters {
-					rChan <- 1
-					return
-				}
-			}
-			rChan <- 0
-		}(&wg, ll, meters, positions, retChan)
+	return p.countNear(ll, meters, func(int) bool { return true })
+}
 
-	}
-	wg.Wait()
+// CountNearOthers is like CountNear but ignores the positions registered for
+// track _trkNum_, for when every track has been registered up front
+func (p *PositionRegistry) CountNearOthers(ll s2.LatLng, meters float64, trkNum int) uint16 {
+	return p.countNear(ll, meters, func(trk int) bool { return trk != trkNum })
+}
 
-	for range p.SeenPos {
-		ret += <-retChan
+func (p *PositionRegistry) countNear(ll s2.LatLng, meters float64, include func(trk int) bool) uint16 {
+	p.ensureIndex(meters)
+	rad := meters / earthMeters
+	cell := s2.CellIDFromLatLng(ll).Parent(p.indexLevel)
+	counted := map[int]bool{}
+	for _, c := range append(cell.AllNeighbors(p.indexLevel), cell) {
+		for _, pos := range p.index[c] {
+			if counted[pos.trk] || !include(pos.trk) {
+				continue
+			}
+			if pos.ll.Distance(ll).Radians() < rad {
+				counted[pos.trk] = true
+			}
+		}
 	}
-
-	return ret
+	return uint16(len(counted))
 }
 
 // AddFromColorPath adds all the positions in a colorpath to the registry
@@ -58,5 +72,35 @@ func (p *PositionRegistry) AddFromColorPath(cp *colorpath.ColorPath, trkNum int)
 	}
 	for _, pos := range cp.Positions {
 		p.SeenPos[trkNum] = append(p.SeenPos[trkNum], pos.LatLng)
+		if p.index != nil {
+			p.addToIndex(pos.LatLng, trkNum)
+		}
 	}
 }
+
+// indexLevelFor picks the deepest s2 cell level whose cells are still at least
+// _meters_ meters wide everywhere on the globe
+func indexLevelFor(meters float64) int {
+	return s2.MinWidthMetric.MaxLevel(meters / earthMeters)
+}
+
+// ensureIndex (re)builds the spatial index from SeenPos if it hasn't been built
+// yet or was built for a different distance
+func (p *PositionRegistry) ensureIndex(meters float64) {
+	level := indexLevelFor(meters)
+	if p.index != nil && p.indexLevel == level {
+		return
+	}
+	p.index = map[s2.CellID][]indexedPos{}
+	p.indexLevel = level
+	for trk, positions := range p.SeenPos {
+		for _, ll := range positions {
+			p.addToIndex(ll, trk)
+		}
+	}
+}
+
+func (p *PositionRegistry) addToIndex(ll s2.LatLng, trk int) {
+	c := s2.CellIDFromLatLng(ll).Parent(p.indexLevel)
+	p.index[c] = append(p.index[c], indexedPos{ll: ll, trk: trk})
+}
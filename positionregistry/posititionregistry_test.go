@@ -1,9 +1,11 @@
 package positionregistry
 
 import (
+	"math/rand"
 	"testing"
 
 	"github.com/golang/geo/s2"
+	"github.com/meekmichael/gpxrainbow/colorpath"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -64,3 +66,98 @@ func TestPositionRegistry_CountNear(t *testing.T) {
 		})
 	}
 }
+
+// countNearLinear is the brute force reference implementation: check every
+// point of every prior track
+func countNearLinear(seen map[int][]s2.LatLng, ll s2.LatLng, meters float64) uint16 {
+	ret := uint16(0)
+	for _, positions := range seen {
+		for _, prevPt := range positions {
+			if prevPt.Distance(ll).Radians()*earthMeters < meters {
+				ret++
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// randomTracks builds _tracks_ random walks of _points_ points each, roughly
+// 5 meters apart, all starting in the same neighborhood
+func randomTracks(tracks, points int) map[int][]s2.LatLng {
+	rnd := rand.New(rand.NewSource(42))
+	seen := map[int][]s2.LatLng{}
+	for trk := 0; trk < tracks; trk++ {
+		lat := 45 + rnd.Float64()*0.01
+		lng := 45 + rnd.Float64()*0.01
+		for i := 0; i < points; i++ {
+			lat += (rnd.Float64() - 0.5) * 0.0001
+			lng += (rnd.Float64() - 0.5) * 0.0001
+			seen[trk] = append(seen[trk], s2.LatLngFromDegrees(lat, lng))
+		}
+	}
+	return seen
+}
+
+func TestPositionRegistry_CountNearMatchesLinear(t *testing.T) {
+	seen := randomTracks(50, 500)
+	rnd := rand.New(rand.NewSource(7))
+	for _, meters := range []float64{1, 10, 100, 1000} {
+		p := &PositionRegistry{SeenPos: seen}
+		for i := 0; i < 200; i++ {
+			ll := s2.LatLngFromDegrees(45+rnd.Float64()*0.01, 45+rnd.Float64()*0.01)
+			assert.Equal(t, countNearLinear(seen, ll, meters), p.CountNear(ll, meters), "meters=%v ll=%v", meters, ll)
+		}
+	}
+}
+
+func TestPositionRegistry_AddFromColorPath(t *testing.T) {
+	p := &PositionRegistry{}
+	ll := s2.LatLngFromDegrees(45, 45)
+	assert.Equal(t, uint16(0), p.CountNear(ll, 10))
+
+	// adding after the index has been built must update the index too
+	p.AddFromColorPath(&colorpath.ColorPath{Positions: []colorpath.Point{{LatLng: ll}, {LatLng: ll}}}, 1)
+	p.AddFromColorPath(&colorpath.ColorPath{Positions: []colorpath.Point{{LatLng: s2.LatLngFromDegrees(45.00001, 45)}}}, 2)
+	p.AddFromColorPath(&colorpath.ColorPath{Positions: []colorpath.Point{{LatLng: s2.LatLngFromDegrees(46, 45)}}}, 3)
+	assert.Equal(t, uint16(2), p.CountNear(ll, 10))
+}
+
+func benchmarkCountNear(b *testing.B, tracks int, countNear func(p *PositionRegistry, ll s2.LatLng) uint16) {
+	p := &PositionRegistry{SeenPos: randomTracks(tracks, 1000)}
+	ll := s2.LatLngFromDegrees(45.005, 45.005)
+	countNear(p, ll) // build the index outside the timer
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		countNear(p, ll)
+	}
+}
+
+func indexedCountNear(p *PositionRegistry, ll s2.LatLng) uint16 {
+	return p.CountNear(ll, 10)
+}
+
+func linearCountNear(p *PositionRegistry, ll s2.LatLng) uint16 {
+	return countNearLinear(p.SeenPos, ll, 10)
+}
+
+func BenchmarkCountNear_Indexed30(b *testing.B)  { benchmarkCountNear(b, 30, indexedCountNear) }
+func BenchmarkCountNear_Indexed300(b *testing.B) { benchmarkCountNear(b, 300, indexedCountNear) }
+func BenchmarkCountNear_Linear30(b *testing.B)   { benchmarkCountNear(b, 30, linearCountNear) }
+func BenchmarkCountNear_Linear300(b *testing.B)  { benchmarkCountNear(b, 300, linearCountNear) }
+
+func TestPositionRegistry_CountNearOthers(t *testing.T) {
+	seen := randomTracks(20, 200)
+	p := &PositionRegistry{SeenPos: seen}
+	for trk, positions := range seen {
+		others := map[int][]s2.LatLng{}
+		for o, pos := range seen {
+			if o != trk {
+				others[o] = pos
+			}
+		}
+		for _, ll := range positions[:20] {
+			assert.Equal(t, countNearLinear(others, ll, 10), p.CountNearOthers(ll, 10, trk))
+		}
+	}
+}
@@ -7,6 +7,10 @@ import (
 	sm "github.com/flopp/go-staticmaps"
 )
 
+// NONE is the tile provider for a map without a basemap, the paths and legend
+// on a transparent image without fetching any tiles
+const NONE = "none"
+
 // getTileProviders gets the list of available OpenStreetMap tile providers
 func getTileProviders() []string {
 	tps := sm.GetTileProviders()
@@ -25,11 +29,15 @@ func ListTileProvider() {
 	for _, n := range tps {
 		fmt.Println(n)
 	}
+	fmt.Printf("%s (no basemap, transparent)\n", NONE)
 	os.Exit(0)
 }
 
 // ValidateTileProvider is for checking cli args
 func ValidateTileProvider(s string) bool {
+	if s == NONE {
+		return true
+	}
 	for _, tp := range getTileProviders() {
 		if tp == s {
 			return true
@@ -38,7 +46,11 @@ func ValidateTileProvider(s string) bool {
 	return false
 }
 
+// ProviderByName finds a tile provider, NONE is one with no tiles
 func ProviderByName(name string) *sm.TileProvider {
+	if name == NONE {
+		return &sm.TileProvider{Name: NONE, TileSize: 256}
+	}
 	for _, tp := range sm.GetTileProviders() {
 		if tp.Name == name {
 			return tp
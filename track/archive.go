@@ -0,0 +1,161 @@
+package track
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Bulk exports from Strava and Garmin are a zip of mostly gzipped GPX and FIT
+// files.  Both are read in place, nothing is extracted to disk.
+
+// gunzip returns a reader for the decompressed contents of r if it's gzipped,
+// otherwise r itself, and the name of the file without a .gz extension
+func gunzip(name string, r io.Reader) (string, io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(2)
+	if len(magic) < 2 || magic[0] != 0x1f || magic[1] != 0x8b {
+		return name, br, nil
+	}
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return name, nil, err
+	}
+	if strings.EqualFold(filepath.Ext(name), ".gz") {
+		name = name[:len(name)-3]
+	}
+	return name, gz, nil
+}
+
+// isArchive is whether a file is a zip archive of input files
+func isArchive(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".zip")
+}
+
+// zipMagic starts every zip archive, KMZ included
+var zipMagic = []byte("PK\x03\x04")
+
+// sharedZip is a zip archive opened when the first of its entries is read, and
+// closed again once every entry has been, so sources that are never loaded
+// don't hold a file open
+type sharedZip struct {
+	filename string
+	mu       sync.Mutex
+	rc       *zip.ReadCloser
+	pending  int
+}
+
+// open opens entry i of the archive, in the order zip.Reader lists them
+func (z *sharedZip) open(i int) (io.ReadCloser, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if z.rc == nil {
+		rc, err := zip.OpenReader(z.filename)
+		if err != nil {
+			z.pending--
+			return nil, err
+		}
+		z.rc = rc
+	}
+	r, err := z.rc.File[i].Open()
+	if err != nil {
+		z.doneLocked()
+		return nil, err
+	}
+	return &zipEntry{ReadCloser: r, archive: z}, nil
+}
+
+func (z *sharedZip) done() {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	z.doneLocked()
+}
+
+func (z *sharedZip) doneLocked() {
+	z.pending--
+	if z.pending == 0 && z.rc != nil {
+		z.rc.Close()
+		z.rc = nil
+	}
+}
+
+type zipEntry struct {
+	io.ReadCloser
+	archive *sharedZip
+}
+
+func (e *zipEntry) Close() error {
+	err := e.ReadCloser.Close()
+	e.archive.done()
+	return err
+}
+
+// zipInputs returns the indexes of the input files in a zip archive, sorted
+// by name
+func zipInputs(zr *zip.Reader) []int {
+	entries := []int{}
+	for i, zf := range zr.File {
+		if !zf.FileInfo().IsDir() && isInputFile(zf.Name) {
+			entries = append(entries, i)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return zr.File[entries[i]].Name < zr.File[entries[j]].Name })
+	return entries
+}
+
+// zipSources returns a source for every input file in a zip archive, sorted by
+// name.  The archive is only read for its list of files here, it's opened
+// again when the first of them is loaded.
+func zipSources(filename string) ([]Source, error) {
+	rc, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	entries := zipInputs(&rc.Reader)
+	archive := &sharedZip{filename: filename, pending: len(entries)}
+	sources := []Source{}
+	for _, i := range entries {
+		i := i
+		sources = append(sources, Source{
+			Name: filepath.Join(filename, filepath.FromSlash(rc.File[i].Name)),
+			Open: func() (io.ReadCloser, error) { return archive.open(i) },
+		})
+	}
+	return sources, nil
+}
+
+// stdinSources returns the source for stdin, or a source for every input file
+// in it if it's a zip archive.  A KMZ is a zip with a .kml in it, so it's read
+// that way too.
+func stdinSources(stdin io.Reader) ([]Source, error) {
+	br := bufio.NewReader(stdin)
+	if magic, _ := br.Peek(len(zipMagic)); !bytes.Equal(magic, zipMagic) {
+		return []Source{ReaderSource("stdin", br)}, nil
+	}
+	data, err := ioutil.ReadAll(br)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("stdin: %v", err)
+	}
+	sources := []Source{}
+	for _, i := range zipInputs(zr) {
+		zf := zr.File[i]
+		sources = append(sources, Source{
+			Name: filepath.Join("stdin", filepath.FromSlash(zf.Name)),
+			Open: zf.Open,
+		})
+	}
+	return sources, nil
+}
@@ -0,0 +1,118 @@
+package track
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func gzipped(t *testing.T, data []byte) []byte {
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	_, err := zw.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestReadGzip(t *testing.T) {
+	data := gzipped(t, []byte(fmt.Sprintf(testGPX, 1)))
+	for _, name := range []string{"ride.gpx.gz", "ride.gz", "stdin"} {
+		f, err := Read(name, bytes.NewReader(data))
+		assert.NoError(t, err, name)
+		assert.Equal(t, name, f.Name)
+		assert.Equal(t, "ride 1", f.Tracks[0].Name)
+	}
+	f, err := Read("ride.fit.gz", bytes.NewReader(gzipped(t, testFIT())))
+	assert.NoError(t, err)
+	assert.Equal(t, 150.0, f.Tracks[0].Segments[0].Points[0].HeartRate.Value())
+
+	_, err = Read("ride.gpx.gz", bytes.NewReader(data[:20]))
+	assert.Error(t, err)
+}
+
+func TestZipSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gpxrainbow")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for name, data := range map[string][]byte{
+		"activities/2.gpx.gz": gzipped(t, []byte(fmt.Sprintf(testGPX, 2))),
+		"activities/1.gpx":    []byte(fmt.Sprintf(testGPX, 1)),
+		"activities/3.fit.gz": gzipped(t, testFIT()),
+		"activities.csv":      []byte("id,name\n"),
+		"media/photo.jpg":     []byte("jpeg"),
+	} {
+		w, err := zw.Create(name)
+		assert.NoError(t, err)
+		_, err = w.Write(data)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zw.Close())
+	export := filepath.Join(dir, "export.zip")
+	assert.NoError(t, ioutil.WriteFile(export, buf.Bytes(), 0644))
+
+	// archives are found when walking directories too
+	for _, arg := range []string{export, dir} {
+		sources, err := Expand([]string{arg}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			"export.zip/activities/1.gpx",
+			"export.zip/activities/2.gpx.gz",
+			"export.zip/activities/3.fit.gz",
+		}, sourceNames(dir, sources))
+
+		files, err := LoadAll(sources, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, "ride 1", files[0].Tracks[0].Name)
+		assert.Equal(t, "ride 2", files[1].Tracks[0].Name)
+		assert.Equal(t, 150.0, files[2].Tracks[0].Segments[0].Points[0].HeartRate.Value())
+	}
+}
+
+// TestStdinZip checks a zip or KMZ piped in is read like one named on the
+// command line
+func TestStdinZip(t *testing.T) {
+	zipped := func(files map[string][]byte) []byte {
+		buf := &bytes.Buffer{}
+		zw := zip.NewWriter(buf)
+		for name, data := range files {
+			w, err := zw.Create(name)
+			assert.NoError(t, err)
+			_, err = w.Write(data)
+			assert.NoError(t, err)
+		}
+		assert.NoError(t, zw.Close())
+		return buf.Bytes()
+	}
+
+	export := zipped(map[string][]byte{
+		"activities/1.gpx":    []byte(fmt.Sprintf(testGPX, 1)),
+		"activities/2.gpx.gz": gzipped(t, []byte(fmt.Sprintf(testGPX, 2))),
+		"activities.csv":      []byte("id,name\n"),
+	})
+	sources, err := Expand([]string{StdinName}, bytes.NewReader(export))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"stdin/activities/1.gpx", "stdin/activities/2.gpx.gz"}, sourceNames("", sources))
+	files, err := LoadAll(sources, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "ride 1", files[0].Tracks[0].Name)
+	assert.Equal(t, "ride 2", files[1].Tracks[0].Name)
+
+	kmz := zipped(map[string][]byte{"doc.kml": []byte(testKML), "files/icon.png": []byte("png")})
+	sources, err = Expand([]string{StdinName}, bytes.NewReader(kmz))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"stdin/doc.kml"}, sourceNames("", sources))
+	files, err = LoadAll(sources, 1)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, files[0].Tracks)
+}
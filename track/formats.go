@@ -0,0 +1,120 @@
+package track
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/meekmichael/gpxrainbow/fit"
+	"github.com/meekmichael/gpxrainbow/gpxext"
+	"github.com/tkrajina/gpxgo/gpx"
+)
+
+// Format reads one kind of input file
+type Format interface {
+	// Name is the name of the format for error messages, like "GPX"
+	Name() string
+	// Extensions are the lower case file extensions of the format, with the dot
+	Extensions() []string
+	// Detect is whether data looks like this format, for files without a known
+	// extension
+	Detect(data []byte) bool
+	Parse(name string, data []byte) (*File, error)
+}
+
+// formats are tried in order when detecting the format of a file.  GPX goes
+// last, anything not recognized is read as GPX.
+var formats = []Format{fitFormat{}, tcxFormat{}, kmlFormat{}, kmzFormat{}, geoJSONFormat{}, gpxFormat{}}
+
+// RegisterFormat adds a reader for another format, ahead of the built in ones.
+// It isn't safe to call while files are loading, call it from init().
+func RegisterFormat(f Format) {
+	formats = append([]Format{f}, formats...)
+}
+
+// formatFor returns the format for the extension of a file name, nil if no
+// format has it
+func formatFor(name string) Format {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, f := range formats {
+		for _, e := range f.Extensions() {
+			if ext == e {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// Read reads and parses a single input file, which can be gzipped.  The format
+// comes from the extension of _name_, or from the contents if the extension
+// isn't known.
+func Read(name string, r io.Reader) (*File, error) {
+	inner, r, err := gunzip(name, r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	format := formatFor(inner)
+	if format == nil {
+		format = formats[len(formats)-1]
+		for _, f := range formats {
+			if f.Detect(data) {
+				format = f
+				break
+			}
+		}
+	}
+	f, err := format.Parse(name, data)
+	if err != nil {
+		return nil, fmt.Errorf("likely invalid %s file %s, error: %v", format.Name(), name, err)
+	}
+	return f, nil
+}
+
+// head is the start of a text file, where format detection looks for the root
+// element
+func head(data []byte) []byte {
+	if len(data) > 4096 {
+		return data[:4096]
+	}
+	return data
+}
+
+type gpxFormat struct{}
+
+func (gpxFormat) Name() string            { return "GPX" }
+func (gpxFormat) Extensions() []string    { return []string{".gpx"} }
+func (gpxFormat) Detect(data []byte) bool { return bytes.Contains(head(data), []byte("<gpx")) }
+
+func (gpxFormat) Parse(name string, data []byte) (*File, error) {
+	gpxdata, err := gpx.ParseBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	ext, err := gpxext.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return FromGPX(name, gpxdata, ext), nil
+}
+
+type fitFormat struct{}
+
+func (fitFormat) Name() string            { return "FIT" }
+func (fitFormat) Extensions() []string    { return []string{".fit"} }
+func (fitFormat) Detect(data []byte) bool { return fit.IsFIT(data) }
+
+func (fitFormat) Parse(name string, data []byte) (*File, error) {
+	act, err := fit.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	return FromFIT(name, act), nil
+}
@@ -0,0 +1,186 @@
+package track
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testTCX = `<?xml version="1.0" encoding="UTF-8"?>
+<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2"
+  xmlns:ns3="http://www.garmin.com/xmlschemas/ActivityExtension/v2">
+  <Activities>
+    <Activity Sport="Biking">
+      <Id>2021-05-01T06:00:00Z</Id>
+      <Lap StartTime="2021-05-01T06:00:00Z">
+        <Track>
+          <Trackpoint>
+            <Time>2021-05-01T06:00:00Z</Time>
+            <Position><LatitudeDegrees>45.0</LatitudeDegrees><LongitudeDegrees>-93.0</LongitudeDegrees></Position>
+            <AltitudeMeters>250.5</AltitudeMeters>
+            <HeartRateBpm><Value>120</Value></HeartRateBpm>
+            <Cadence>85</Cadence>
+            <Extensions><ns3:TPX><ns3:Watts>210</ns3:Watts></ns3:TPX></Extensions>
+          </Trackpoint>
+          <Trackpoint>
+            <Time>2021-05-01T06:00:01Z</Time>
+            <HeartRateBpm><Value>121</Value></HeartRateBpm>
+          </Trackpoint>
+          <Trackpoint>
+            <Time>2021-05-01T06:00:02Z</Time>
+            <Position><LatitudeDegrees>45.0001</LatitudeDegrees><LongitudeDegrees>-93.0</LongitudeDegrees></Position>
+          </Trackpoint>
+        </Track>
+      </Lap>
+      <Lap StartTime="2021-05-01T07:00:00Z">
+        <Track>
+          <Trackpoint>
+            <Time>2021-05-01T07:00:00Z</Time>
+            <Position><LatitudeDegrees>45.0002</LatitudeDegrees><LongitudeDegrees>-93.0</LongitudeDegrees></Position>
+          </Trackpoint>
+        </Track>
+      </Lap>
+    </Activity>
+  </Activities>
+</TrainingCenterDatabase>`
+
+const testKML = `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2" xmlns:gx="http://www.google.com/kml/ext/2.2">
+  <Document>
+    <name>document</name>
+    <Placemark>
+      <name>planned</name>
+      <MultiGeometry>
+        <LineString><coordinates>-93.0,45.0,250 -93.0,45.0001,251</coordinates></LineString>
+        <LineString><coordinates>
+          -93.0,45.0002 -93.0,45.0003
+        </coordinates></LineString>
+      </MultiGeometry>
+    </Placemark>
+    <Placemark>
+      <name>a stop</name>
+      <Point><coordinates>-93.0,45.0</coordinates></Point>
+    </Placemark>
+    <Placemark>
+      <name>recorded</name>
+      <gx:Track>
+        <when>2021-05-01T06:00:00Z</when>
+        <when>2021-05-01T06:00:05Z</when>
+        <gx:coord>-93.0 45.0 250</gx:coord>
+        <gx:coord>-93.0 45.0001 252</gx:coord>
+      </gx:Track>
+    </Placemark>
+  </Document>
+</kml>`
+
+const testGeoJSON = `{
+  "type": "FeatureCollection",
+  "features": [
+    {
+      "type": "Feature",
+      "properties": {"name": "morning", "coordTimes": ["2021-05-01T06:00:00Z", "2021-05-01T06:00:05Z"]},
+      "geometry": {"type": "LineString", "coordinates": [[-93.0, 45.0, 250], [-93.0, 45.0001, 251]]}
+    },
+    {
+      "type": "Feature",
+      "properties": {"name": "two parts"},
+      "geometry": {"type": "MultiLineString", "coordinates": [[[-93.0, 45.0], [-93.0, 45.0001]], [[-93.0, 45.0002], [-93.0, 45.0003]]]}
+    },
+    {
+      "type": "Feature",
+      "properties": {"name": "a stop"},
+      "geometry": {"type": "Point", "coordinates": [-93.0, 45.0]}
+    }
+  ]
+}`
+
+func TestReadTCX(t *testing.T) {
+	f, err := Read("ride.tcx", strings.NewReader(testTCX))
+	assert.NoError(t, err)
+	assert.Len(t, f.Tracks, 1)
+	assert.Equal(t, "2021-05-01T06:00:00Z", f.Tracks[0].Name)
+	segs := f.Tracks[0].Segments
+	assert.Len(t, segs, 2)
+	// the point without a position is skipped
+	assert.Len(t, segs[0].Points, 2)
+	pt := segs[0].Points[0]
+	assert.Equal(t, 45.0, pt.Latitude)
+	assert.Equal(t, -93.0, pt.Longitude)
+	assert.Equal(t, 250.5, pt.Elevation.Value())
+	assert.Equal(t, 120.0, pt.HeartRate.Value())
+	assert.Equal(t, 85.0, pt.Cadence.Value())
+	assert.Equal(t, 210.0, pt.Power.Value())
+	assert.Equal(t, time.Date(2021, 5, 1, 6, 0, 0, 0, time.UTC), pt.Timestamp)
+	assert.True(t, segs[0].Points[1].HeartRate.Null())
+}
+
+func TestReadKML(t *testing.T) {
+	f, err := Read("ride.kml", strings.NewReader(testKML))
+	assert.NoError(t, err)
+	assert.Len(t, f.Tracks, 2)
+
+	assert.Equal(t, "planned", f.Tracks[0].Name)
+	assert.Len(t, f.Tracks[0].Segments, 2)
+	pt := f.Tracks[0].Segments[0].Points[1]
+	assert.Equal(t, 45.0001, pt.Latitude)
+	assert.Equal(t, -93.0, pt.Longitude)
+	assert.Equal(t, 251.0, pt.Elevation.Value())
+	assert.True(t, pt.Timestamp.IsZero())
+	assert.True(t, f.Tracks[0].Segments[1].Points[0].Elevation.Null())
+
+	assert.Equal(t, "recorded", f.Tracks[1].Name)
+	pts := f.Tracks[1].Segments[0].Points
+	assert.Len(t, pts, 2)
+	assert.Equal(t, 252.0, pts[1].Elevation.Value())
+	assert.Equal(t, time.Date(2021, 5, 1, 6, 0, 5, 0, time.UTC), pts[1].Timestamp)
+}
+
+func TestReadKMZ(t *testing.T) {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	w, err := zw.Create("doc.kml")
+	assert.NoError(t, err)
+	_, err = w.Write([]byte(testKML))
+	assert.NoError(t, err)
+	assert.NoError(t, zw.Close())
+
+	f, err := Read("ride.kmz", buf)
+	assert.NoError(t, err)
+	assert.Len(t, f.Tracks, 2)
+}
+
+func TestReadGeoJSON(t *testing.T) {
+	f, err := Read("ride.geojson", strings.NewReader(testGeoJSON))
+	assert.NoError(t, err)
+	assert.Len(t, f.Tracks, 2)
+
+	assert.Equal(t, "morning", f.Tracks[0].Name)
+	pts := f.Tracks[0].Segments[0].Points
+	assert.Len(t, pts, 2)
+	assert.Equal(t, 45.0001, pts[1].Latitude)
+	assert.Equal(t, -93.0, pts[1].Longitude)
+	assert.Equal(t, 251.0, pts[1].Elevation.Value())
+	assert.Equal(t, time.Date(2021, 5, 1, 6, 0, 5, 0, time.UTC), pts[1].Timestamp)
+
+	assert.Equal(t, "two parts", f.Tracks[1].Name)
+	assert.Len(t, f.Tracks[1].Segments, 2)
+	assert.True(t, f.Tracks[1].Segments[0].Points[0].Timestamp.IsZero())
+}
+
+func TestDetectFormat(t *testing.T) {
+	for _, doc := range []string{testTCX, testKML, testGeoJSON} {
+		f, err := Read("stdin", strings.NewReader(doc))
+		assert.NoError(t, err)
+		assert.NotEmpty(t, f.Tracks)
+	}
+	_, err := Read("stdin", strings.NewReader("not a track"))
+	assert.EqualError(t, err, "likely invalid GPX file stdin, error: EOF")
+
+	assert.True(t, isInputFile("a/ride.TCX"))
+	assert.True(t, isInputFile("ride.geojson"))
+	assert.False(t, isInputFile("notes.txt"))
+}
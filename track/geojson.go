@@ -0,0 +1,133 @@
+package track
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// GeoJSON LineStrings and MultiLineStrings, each feature is a track.  Positions
+// are [lon, lat] or [lon, lat, elevation].  Timestamps come from a
+// "coordTimes" property lined up with the coordinates, the way togeojson and
+// Mapbox write them.
+
+type geoJSONObject struct {
+	Type        string          `json:"type"`
+	Features    []geoJSONObject `json:"features"`
+	Geometry    *geoJSONObject  `json:"geometry"`
+	Geometries  []geoJSONObject `json:"geometries"`
+	Coordinates json.RawMessage `json:"coordinates"`
+	Properties  struct {
+		Name       string          `json:"name"`
+		CoordTimes json.RawMessage `json:"coordTimes"`
+	} `json:"properties"`
+}
+
+type geoJSONFormat struct{}
+
+func (geoJSONFormat) Name() string         { return "GeoJSON" }
+func (geoJSONFormat) Extensions() []string { return []string{".geojson"} }
+
+func (geoJSONFormat) Detect(data []byte) bool {
+	trimmed := bytes.TrimSpace(head(data))
+	return len(trimmed) > 0 && trimmed[0] == '{' && bytes.Contains(trimmed, []byte(`"type"`))
+}
+
+func (geoJSONFormat) Parse(name string, data []byte) (*File, error) {
+	obj := geoJSONObject{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	f := &File{Name: name}
+	if err := geoJSONTracks(f, &obj); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// geoJSONTracks adds a track to f for every feature or bare geometry with lines
+func geoJSONTracks(f *File, obj *geoJSONObject) error {
+	switch obj.Type {
+	case "FeatureCollection":
+		for i := range obj.Features {
+			if err := geoJSONTracks(f, &obj.Features[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "Feature":
+		if obj.Geometry == nil {
+			return nil
+		}
+		track := Track{Name: obj.Properties.Name}
+		times := [][]string{}
+		if len(obj.Properties.CoordTimes) > 0 {
+			// a list for a LineString, a list of lists for a MultiLineString
+			single := []string{}
+			if json.Unmarshal(obj.Properties.CoordTimes, &single) == nil {
+				times = append(times, single)
+			} else if err := json.Unmarshal(obj.Properties.CoordTimes, &times); err != nil {
+				return err
+			}
+		}
+		if err := geoJSONSegments(&track, obj.Geometry, times); err != nil {
+			return err
+		}
+		if len(track.Segments) > 0 {
+			f.Tracks = append(f.Tracks, track)
+		}
+		return nil
+	}
+	track := Track{}
+	if err := geoJSONSegments(&track, obj, nil); err != nil {
+		return err
+	}
+	if len(track.Segments) > 0 {
+		f.Tracks = append(f.Tracks, track)
+	}
+	return nil
+}
+
+// geoJSONSegments adds a segment to track for every line of a geometry, times
+// holds the timestamps of each line
+func geoJSONSegments(track *Track, geom *geoJSONObject, times [][]string) error {
+	lines := [][][]float64{}
+	switch geom.Type {
+	case "LineString":
+		line := [][]float64{}
+		if err := json.Unmarshal(geom.Coordinates, &line); err != nil {
+			return err
+		}
+		lines = append(lines, line)
+	case "MultiLineString":
+		if err := json.Unmarshal(geom.Coordinates, &lines); err != nil {
+			return err
+		}
+	case "GeometryCollection":
+		for i := range geom.Geometries {
+			if err := geoJSONSegments(track, &geom.Geometries[i], nil); err != nil {
+				return err
+			}
+		}
+	}
+	for l, line := range lines {
+		segment := Segment{}
+		for i, pos := range line {
+			if len(pos) < 2 {
+				continue
+			}
+			pt := Point{Latitude: pos[1], Longitude: pos[0]}
+			if len(pos) > 2 {
+				pt.Elevation.SetValue(pos[2])
+			}
+			if l < len(times) && i < len(times[l]) {
+				pt.Timestamp, _ = time.Parse(time.RFC3339Nano, times[l][i])
+			}
+			segment.Points = append(segment.Points, pt)
+		}
+		if len(segment.Points) > 0 {
+			track.Segments = append(track.Segments, segment)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package track
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// StdinName is the command line argument for reading a file from stdin
+const StdinName = "-"
+
+// isInputFile is whether a file found in a directory or archive should be
+// loaded, gzipped or not
+func isInputFile(name string) bool {
+	if strings.EqualFold(filepath.Ext(name), ".gz") {
+		name = name[:len(name)-3]
+	}
+	return formatFor(name) != nil
+}
+
+// Expand turns command line arguments into sources.  An argument can be `-` for
+// stdin, a file, a directory which is walked recursively for input files, or a
+// glob pattern, where `**` matches any number of directories and only input
+// files are picked up.  Files can be gzipped, and zip archives, on stdin too,
+// are read for the input files in them.  Arguments are kept in order, the files each directory or
+// pattern expands to are sorted, and a file named more than once, however it's
+// written, is only read the first time.
+func Expand(args []string, stdin io.Reader) ([]Source, error) {
+	sources := []Source{}
+	seen := map[string]bool{}
+	add := func(filename string) error {
+		key, err := filepath.Abs(filename)
+		if err != nil {
+			key = filepath.Clean(filename)
+		}
+		if seen[key] {
+			return nil
+		}
+		seen[key] = true
+		if !isArchive(filename) {
+			sources = append(sources, FileSource(filename))
+			return nil
+		}
+		entries, err := zipSources(filename)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, entries...)
+		return nil
+	}
+	for _, arg := range args {
+		if arg == StdinName {
+			if seen[StdinName] {
+				return nil, fmt.Errorf("stdin (%s) can only be read once", StdinName)
+			}
+			seen[StdinName] = true
+			entries, err := stdinSources(stdin)
+			if err != nil {
+				return nil, err
+			}
+			sources = append(sources, entries...)
+			continue
+		}
+		filenames, err := expandArg(arg)
+		if err != nil {
+			return nil, err
+		}
+		for _, filename := range filenames {
+			if err := add(filename); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return sources, nil
+}
+
+// expandArg returns the sorted files a single non-stdin argument refers to
+func expandArg(arg string) ([]string, error) {
+	info, err := os.Stat(arg)
+	if err == nil {
+		if info.IsDir() {
+			return walkDir(arg)
+		}
+		return []string{arg}, nil
+	}
+	if !hasMeta(arg) {
+		return nil, err
+	}
+	matches, err := glob(arg)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no files match %s", arg)
+	}
+	filenames := []string{}
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && info.IsDir() {
+			found, err := walkDir(match)
+			if err != nil {
+				return nil, err
+			}
+			filenames = append(filenames, found...)
+		} else if isInputFile(match) || isArchive(match) {
+			filenames = append(filenames, match)
+		}
+	}
+	if len(filenames) == 0 {
+		return nil, fmt.Errorf("no input files match %s", arg)
+	}
+	sort.Strings(filenames)
+	return filenames, nil
+}
+
+// walkDir returns every input file and archive under dir, sorted
+func walkDir(dir string) ([]string, error) {
+	filenames := []string{}
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && (isInputFile(p) || isArchive(p)) {
+			filenames = append(filenames, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(filenames)
+	return filenames, nil
+}
+
+func hasMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// glob is filepath.Glob plus `**` for any number of directories
+func glob(pattern string) ([]string, error) {
+	if !strings.Contains(pattern, "**") {
+		return filepath.Glob(pattern)
+	}
+	// only walk from the deepest directory without any pattern characters
+	parts := strings.Split(filepath.ToSlash(pattern), "/")
+	root := []string{}
+	for _, part := range parts {
+		if hasMeta(part) {
+			break
+		}
+		root = append(root, part)
+	}
+	rootDir := strings.Join(root, "/")
+	if rootDir == "" {
+		rootDir = "."
+	}
+	if len(root) == 1 && root[0] == "" {
+		rootDir = "/"
+	}
+	patParts := parts[len(root):]
+
+	matches := []string{}
+	err := filepath.Walk(filepath.FromSlash(rootDir), func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(rootDir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		ok, err := matchParts(patParts, strings.Split(filepath.ToSlash(rel), "/"))
+		if err != nil {
+			return err
+		}
+		if ok {
+			matches = append(matches, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// matchParts matches the / separated parts of a path against those of a pattern
+func matchParts(pattern, name []string) (bool, error) {
+	if len(pattern) == 0 {
+		return len(name) == 0, nil
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if ok, err := matchParts(pattern[1:], name[i:]); ok || err != nil {
+				return ok, err
+			}
+		}
+		return false, nil
+	}
+	if len(name) == 0 {
+		return false, nil
+	}
+	ok, err := filepath.Match(pattern[0], name[0])
+	if !ok || err != nil {
+		return false, err
+	}
+	return matchParts(pattern[1:], name[1:])
+}
@@ -0,0 +1,108 @@
+package track
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeTree(t *testing.T, files ...string) string {
+	dir, err := ioutil.TempDir("", "gpxrainbow")
+	assert.NoError(t, err)
+	for _, f := range files {
+		name := filepath.Join(dir, filepath.FromSlash(f))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(name), 0755))
+		assert.NoError(t, ioutil.WriteFile(name, []byte("x"), 0644))
+	}
+	return dir
+}
+
+func sourceNames(dir string, sources []Source) []string {
+	names := []string{}
+	for _, src := range sources {
+		rel, err := filepath.Rel(dir, src.Name)
+		if err != nil {
+			rel = src.Name
+		}
+		names = append(names, filepath.ToSlash(rel))
+	}
+	return names
+}
+
+func TestExpand(t *testing.T) {
+	dir := makeTree(t,
+		"2020/12/b.gpx", "2020/12/a.GPX", "2020/notes.txt",
+		"2021/01/c.gpx", "2021/02/d.gpx", "top.gpx",
+	)
+	defer os.RemoveAll(dir)
+	in := func(p string) string { return filepath.Join(dir, filepath.FromSlash(p)) }
+
+	// directories are walked, skipping other files, sorted
+	sources, err := Expand([]string{dir}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2020/12/a.GPX", "2020/12/b.gpx", "2021/01/c.gpx", "2021/02/d.gpx", "top.gpx"}, sourceNames(dir, sources))
+
+	// arguments keep their order, files given twice are read once, however
+	// they're written
+	sources, err = Expand([]string{in("2021"), in("top.gpx"), in("2021/01/c.gpx"), dir + "/2021/02/../01/c.gpx", dir + "//2021/./02/d.gpx"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2021/01/c.gpx", "2021/02/d.gpx", "top.gpx"}, sourceNames(dir, sources))
+
+	sources, err = Expand([]string{in("202?/*")}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2020/12/a.GPX", "2020/12/b.gpx", "2021/01/c.gpx", "2021/02/d.gpx"}, sourceNames(dir, sources))
+
+	// a pattern that only matches other files
+	_, err = Expand([]string{in("2020/*.txt")}, nil)
+	assert.Error(t, err)
+
+	sources, err = Expand([]string{in("**/*.gpx")}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2020/12/b.gpx", "2021/01/c.gpx", "2021/02/d.gpx", "top.gpx"}, sourceNames(dir, sources))
+
+	sources, err = Expand([]string{in("2021/**/d.gpx")}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2021/02/d.gpx"}, sourceNames(dir, sources))
+
+	_, err = Expand([]string{in("*.fit")}, nil)
+	assert.Error(t, err)
+	_, err = Expand([]string{in("missing.gpx")}, nil)
+	assert.Error(t, err)
+}
+
+func TestExpandStdin(t *testing.T) {
+	sources, err := Expand([]string{StdinName}, strings.NewReader("stdin data"))
+	assert.NoError(t, err)
+	assert.Len(t, sources, 1)
+	r, err := sources[0].Open()
+	assert.NoError(t, err)
+	data, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "stdin data", string(data))
+
+	_, err = Expand([]string{StdinName, StdinName}, strings.NewReader(""))
+	assert.Error(t, err)
+}
+
+func TestMatchParts(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, name string
+		match         bool
+	}{
+		{"**", "a/b/c.gpx", true},
+		{"**/*.gpx", "c.gpx", true},
+		{"**/*.gpx", "a/b/c.gpx", true},
+		{"a/**/c.gpx", "a/c.gpx", true},
+		{"a/**/c.gpx", "a/x/y/c.gpx", true},
+		{"a/**/c.gpx", "b/x/c.gpx", false},
+		{"*/c.gpx", "a/b/c.gpx", false},
+	} {
+		ok, err := matchParts(strings.Split(tc.pattern, "/"), strings.Split(tc.name, "/"))
+		assert.NoError(t, err)
+		assert.Equal(t, tc.match, ok, "%s %s", tc.pattern, tc.name)
+	}
+}
@@ -0,0 +1,167 @@
+package track
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KML from Google Earth and friends.  Each Placemark with a path is a track,
+// every <LineString> or <gx:Track> in it is a segment.  LineStrings are just
+// coordinates, gx:Tracks have a <when> timestamp for each <gx:coord>.  Elements
+// are matched by local name so the namespace prefix doesn't matter.
+
+type kmlFormat struct{}
+
+func (kmlFormat) Name() string            { return "KML" }
+func (kmlFormat) Extensions() []string    { return []string{".kml"} }
+func (kmlFormat) Detect(data []byte) bool { return bytes.Contains(head(data), []byte("<kml")) }
+
+func (kmlFormat) Parse(name string, data []byte) (*File, error) {
+	return parseKML(name, data)
+}
+
+// kmzFormat is zipped KML, the first .kml in the archive is the document
+type kmzFormat struct{}
+
+func (kmzFormat) Name() string            { return "KMZ" }
+func (kmzFormat) Extensions() []string    { return []string{".kmz"} }
+func (kmzFormat) Detect(data []byte) bool { return false }
+
+func (kmzFormat) Parse(name string, data []byte) (*File, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	for _, zf := range zr.File {
+		if strings.ToLower(filepath.Ext(zf.Name)) != ".kml" {
+			continue
+		}
+		r, err := zf.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		doc, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return parseKML(name, doc)
+	}
+	return nil, errors.New("no .kml document in the archive")
+}
+
+func parseKML(name string, data []byte) (*File, error) {
+	f := &File{Name: name}
+	d := xml.NewDecoder(bytes.NewReader(data))
+	path := []string{}
+	text := strings.Builder{}
+	var track *Track
+	whens := []time.Time{}
+	coords := []Point{}
+
+	parent := func() string {
+		if len(path) < 2 {
+			return ""
+		}
+		return path[len(path)-2]
+	}
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return f, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			path = append(path, t.Name.Local)
+			text.Reset()
+			switch t.Name.Local {
+			case "Placemark":
+				track = &Track{}
+			case "Track":
+				whens, coords = whens[:0], coords[:0]
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if track != nil {
+				switch {
+				case t.Name.Local == "name" && parent() == "Placemark":
+					track.Name = strings.TrimSpace(text.String())
+				case t.Name.Local == "coordinates" && parent() == "LineString":
+					if points := kmlCoordinates(text.String()); len(points) > 0 {
+						track.Segments = append(track.Segments, Segment{Points: points})
+					}
+				case t.Name.Local == "when" && parent() == "Track":
+					ts, _ := time.Parse(time.RFC3339Nano, strings.TrimSpace(text.String()))
+					whens = append(whens, ts)
+				case t.Name.Local == "coord" && parent() == "Track":
+					if pt, ok := kmlPoint(strings.Fields(text.String())); ok {
+						coords = append(coords, pt)
+					}
+				case t.Name.Local == "Track":
+					if len(coords) > 0 {
+						segment := Segment{Points: make([]Point, len(coords))}
+						for i, pt := range coords {
+							if i < len(whens) {
+								pt.Timestamp = whens[i]
+							}
+							segment.Points[i] = pt
+						}
+						track.Segments = append(track.Segments, segment)
+					}
+				case t.Name.Local == "Placemark":
+					if len(track.Segments) > 0 {
+						f.Tracks = append(f.Tracks, *track)
+					}
+					track = nil
+				}
+			}
+			path = path[:len(path)-1]
+			text.Reset()
+		}
+	}
+}
+
+// kmlCoordinates parses the "lon,lat[,alt] lon,lat[,alt] ..." of a LineString
+func kmlCoordinates(s string) []Point {
+	points := []Point{}
+	for _, tuple := range strings.Fields(s) {
+		if pt, ok := kmlPoint(strings.Split(tuple, ",")); ok {
+			points = append(points, pt)
+		}
+	}
+	return points
+}
+
+// kmlPoint makes a point from longitude, latitude and an optional altitude
+func kmlPoint(fields []string) (Point, bool) {
+	if len(fields) < 2 {
+		return Point{}, false
+	}
+	lon, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return Point{}, false
+	}
+	lat, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return Point{}, false
+	}
+	pt := Point{Latitude: lat, Longitude: lon}
+	if len(fields) > 2 {
+		if alt, err := strconv.ParseFloat(fields[2], 64); err == nil {
+			pt.Elevation.SetValue(alt)
+		}
+	}
+	return pt, true
+}
@@ -0,0 +1,105 @@
+package track
+
+import (
+	"bytes"
+	"encoding/xml"
+	"time"
+
+	"github.com/tkrajina/gpxgo/gpx"
+)
+
+// Training Center XML, from older Garmin devices and Garmin Connect exports.
+// Every <Track> of an activity's laps, or of a course, is a segment.  Elements
+// are matched by local name so the namespace prefix doesn't matter.
+
+type tcxDocument struct {
+	Activities []tcxActivity `xml:"Activities>Activity"`
+	Courses    []tcxActivity `xml:"Courses>Course"`
+}
+
+type tcxActivity struct {
+	ID        string     `xml:"Id"`
+	Name      string     `xml:"Name"`
+	LapTracks []tcxTrack `xml:"Lap>Track"`
+	Tracks    []tcxTrack `xml:"Track"`
+}
+
+type tcxTrack struct {
+	Points []tcxPoint `xml:"Trackpoint"`
+}
+
+type tcxPoint struct {
+	Time       string   `xml:"Time"`
+	Latitude   *float64 `xml:"Position>LatitudeDegrees"`
+	Longitude  *float64 `xml:"Position>LongitudeDegrees"`
+	Altitude   *float64 `xml:"AltitudeMeters"`
+	HeartRate  *float64 `xml:"HeartRateBpm>Value"`
+	Cadence    *float64 `xml:"Cadence"`
+	RunCadence *float64 `xml:"Extensions>TPX>RunCadence"`
+	Watts      *float64 `xml:"Extensions>TPX>Watts"`
+}
+
+type tcxFormat struct{}
+
+func (tcxFormat) Name() string         { return "TCX" }
+func (tcxFormat) Extensions() []string { return []string{".tcx"} }
+
+func (tcxFormat) Detect(data []byte) bool {
+	return bytes.Contains(head(data), []byte("<TrainingCenterDatabase"))
+}
+
+func (tcxFormat) Parse(name string, data []byte) (*File, error) {
+	doc := tcxDocument{}
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	f := &File{Name: name}
+	for _, act := range append(doc.Activities, doc.Courses...) {
+		track := Track{Name: act.Name}
+		if track.Name == "" {
+			track.Name = act.ID
+		}
+		for _, trk := range append(act.LapTracks, act.Tracks...) {
+			segment := Segment{}
+			for _, tp := range trk.Points {
+				if pt, ok := tp.point(); ok {
+					segment.Points = append(segment.Points, pt)
+				}
+			}
+			if len(segment.Points) > 0 {
+				track.Segments = append(track.Segments, segment)
+			}
+		}
+		f.Tracks = append(f.Tracks, track)
+	}
+	return f, nil
+}
+
+// point converts a trackpoint, returning false for the ones without a position
+func (tp tcxPoint) point() (Point, bool) {
+	if tp.Latitude == nil || tp.Longitude == nil {
+		return Point{}, false
+	}
+	pt := Point{
+		Latitude:  *tp.Latitude,
+		Longitude: *tp.Longitude,
+		Elevation: nullable(tp.Altitude),
+		HeartRate: nullable(tp.HeartRate),
+		Cadence:   nullable(tp.Cadence),
+		Power:     nullable(tp.Watts),
+	}
+	if pt.Cadence.Null() {
+		pt.Cadence = nullable(tp.RunCadence)
+	}
+	if ts, err := time.Parse(time.RFC3339Nano, tp.Time); err == nil {
+		pt.Timestamp = ts
+	}
+	return pt, true
+}
+
+func nullable(f *float64) gpx.NullableFloat64 {
+	if f == nil {
+		return gpx.NullableFloat64{}
+	}
+	return *gpx.NewNullableFloat64(*f)
+}
@@ -0,0 +1,218 @@
+package track
+
+import (
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/meekmichael/gpxrainbow/fit"
+	"github.com/meekmichael/gpxrainbow/gpxext"
+	"github.com/tkrajina/gpxgo/gpx"
+)
+
+// the in-memory model of everything read from the input files, so each file
+// only has to be read and parsed once
+
+// Point is a single recorded position and everything measured there
+type Point struct {
+	Latitude  float64
+	Longitude float64
+	Elevation gpx.NullableFloat64
+	Timestamp time.Time
+
+	Cadence   gpx.NullableFloat64
+	HeartRate gpx.NullableFloat64
+	Power     gpx.NullableFloat64
+}
+
+// Segment is an unbroken run of points
+type Segment struct {
+	Points []Point
+}
+
+// Track is a single recorded activity
+type Track struct {
+	Name     string
+	Segments []Segment
+}
+
+// Waypoint is a named point of interest
+type Waypoint struct {
+	Latitude  float64
+	Longitude float64
+	Elevation gpx.NullableFloat64
+	Name      string
+}
+
+// File is everything read from a single input file.  Routes are planned paths,
+// without timestamps or sensor readings.
+type File struct {
+	Name      string
+	Tracks    []Track
+	Routes    []Track
+	Waypoints []Waypoint
+}
+
+// Distance2D is the distance in meters between two points, ignoring elevation
+func (pt *Point) Distance2D(pt2 *Point) float64 {
+	return gpx.Distance2D(pt.Latitude, pt.Longitude, pt2.Latitude, pt2.Longitude, false)
+}
+
+// Distance3D is the distance in meters between two points, including the
+// elevation change if both have one
+func (pt *Point) Distance3D(pt2 *Point) float64 {
+	return gpx.Distance3D(pt.Latitude, pt.Longitude, pt.Elevation, pt2.Latitude, pt2.Longitude, pt2.Elevation, false)
+}
+
+// SpeedBetween is the speed in meters/second between two points, and false if
+// they aren't both timestamped at different times so there's no speed
+func (pt *Point) SpeedBetween(pt2 *Point) (float64, bool) {
+	if pt.Timestamp.IsZero() || pt2.Timestamp.IsZero() || pt.Timestamp.Equal(pt2.Timestamp) {
+		return 0, false
+	}
+	return pt.Distance3D(pt2) / math.Abs(pt.Timestamp.Sub(pt2.Timestamp).Seconds()), true
+}
+
+// Start returns the time of the first timestamped point of a track, or the zero
+// time if none of its points have a timestamp
+func (trk *Track) Start() time.Time {
+	for _, seg := range trk.Segments {
+		for _, pt := range seg.Points {
+			if !pt.Timestamp.IsZero() {
+				return pt.Timestamp
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// FromGPX converts a parsed GPX document and the extension values of its track
+// points into a File
+func FromGPX(name string, gpxdata *gpx.GPX, ext []gpxext.Track) *File {
+	f := &File{Name: name}
+	for t, trk := range gpxdata.Tracks {
+		track := Track{Name: trk.Name}
+		for s, seg := range trk.Segments {
+			segment := Segment{Points: make([]Point, 0, len(seg.Points))}
+			for i, pt := range seg.Points {
+				values := gpxext.At(ext, t, s, i)
+				segment.Points = append(segment.Points, Point{
+					Latitude:  pt.GetLatitude(),
+					Longitude: pt.GetLongitude(),
+					Elevation: pt.Elevation,
+					Timestamp: pt.Timestamp,
+					Cadence:   values.Cadence,
+					HeartRate: values.HeartRate,
+					Power:     values.Power,
+				})
+			}
+			track.Segments = append(track.Segments, segment)
+		}
+		f.Tracks = append(f.Tracks, track)
+	}
+	for _, rte := range gpxdata.Routes {
+		segment := Segment{Points: make([]Point, 0, len(rte.Points))}
+		for _, pt := range rte.Points {
+			segment.Points = append(segment.Points, Point{
+				Latitude:  pt.GetLatitude(),
+				Longitude: pt.GetLongitude(),
+				Elevation: pt.Elevation,
+				Timestamp: pt.Timestamp,
+			})
+		}
+		f.Routes = append(f.Routes, Track{Name: rte.Name, Segments: []Segment{segment}})
+	}
+	for _, wpt := range gpxdata.Waypoints {
+		f.Waypoints = append(f.Waypoints, Waypoint{
+			Latitude:  wpt.GetLatitude(),
+			Longitude: wpt.GetLongitude(),
+			Elevation: wpt.Elevation,
+			Name:      wpt.Name,
+		})
+	}
+	return f
+}
+
+// FromFIT converts a decoded FIT activity into a File with a single track
+func FromFIT(name string, act *fit.Activity) *File {
+	track := Track{}
+	for _, records := range act.Segments {
+		segment := Segment{Points: make([]Point, 0, len(records))}
+		for _, r := range records {
+			segment.Points = append(segment.Points, Point{
+				Latitude:  r.Latitude,
+				Longitude: r.Longitude,
+				Elevation: r.Altitude,
+				Timestamp: r.Timestamp,
+				Cadence:   r.Cadence,
+				HeartRate: r.HeartRate,
+				Power:     r.Power,
+			})
+		}
+		track.Segments = append(track.Segments, segment)
+	}
+	return &File{Name: name, Tracks: []Track{track}}
+}
+
+// Source is somewhere to read an input file from
+type Source struct {
+	Name string
+	Open func() (io.ReadCloser, error)
+}
+
+// FileSource reads from a file on disk
+func FileSource(filename string) Source {
+	return Source{
+		Name: filename,
+		Open: func() (io.ReadCloser, error) { return os.Open(filename) },
+	}
+}
+
+// ReaderSource reads from r, which can only be loaded once
+func ReaderSource(name string, r io.Reader) Source {
+	return Source{
+		Name: name,
+		Open: func() (io.ReadCloser, error) { return ioutil.NopCloser(r), nil },
+	}
+}
+
+// Load reads and parses a single source
+func Load(src Source) (*File, error) {
+	r, err := src.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return Read(src.Name, r)
+}
+
+// LoadAll reads every source, up to _parallel_ at a time.  The files come back
+// in the same order as the sources.
+func LoadAll(sources []Source, parallel int) ([]*File, error) {
+	if parallel < 1 {
+		parallel = 1
+	}
+	files := make([]*File, len(sources))
+	errs := make([]error, len(sources))
+	sem := make(chan struct{}, parallel)
+	wg := sync.WaitGroup{}
+	for i, src := range sources {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, src Source) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			files[i], errs[i] = Load(src)
+		}(i, src)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
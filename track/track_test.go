@@ -0,0 +1,133 @@
+package track
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/meekmichael/gpxrainbow/fit"
+	"github.com/stretchr/testify/assert"
+	"github.com/tkrajina/gpxgo/gpx"
+)
+
+const testGPX = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1"
+  xmlns:gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v1">
+  <trk>
+    <name>ride %d</name>
+    <trkseg>
+      <trkpt lat="45.0" lon="45.0">
+        <ele>100</ele>
+        <time>2021-05-01T06:00:00Z</time>
+        <extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>120</gpxtpx:hr></gpxtpx:TrackPointExtension></extensions>
+      </trkpt>
+      <trkpt lat="45.0001" lon="45.0">
+        <time>2021-05-01T06:00:02Z</time>
+      </trkpt>
+    </trkseg>
+  </trk>
+</gpx>`
+
+func TestLoadAll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gpxrainbow")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filenames := []string{}
+	sources := []Source{}
+	for i := 0; i < 10; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("ride%d.gpx", i))
+		assert.NoError(t, ioutil.WriteFile(name, []byte(fmt.Sprintf(testGPX, i)), 0644))
+		filenames = append(filenames, name)
+		sources = append(sources, FileSource(name))
+	}
+	sources = append(sources, ReaderSource("reader", strings.NewReader(fmt.Sprintf(testGPX, 10))))
+	filenames = append(filenames, "reader")
+
+	files, err := LoadAll(sources, 3)
+	assert.NoError(t, err)
+	assert.Len(t, files, 11)
+	for i, f := range files {
+		assert.Equal(t, filenames[i], f.Name)
+		assert.Equal(t, fmt.Sprintf("ride %d", i), f.Tracks[0].Name)
+	}
+
+	pts := files[0].Tracks[0].Segments[0].Points
+	assert.Len(t, pts, 2)
+	assert.Equal(t, 120.0, pts[0].HeartRate.Value())
+	assert.True(t, pts[1].HeartRate.Null())
+	assert.Equal(t, 100.0, pts[0].Elevation.Value())
+	spd, ok := pts[1].SpeedBetween(&pts[0])
+	assert.True(t, ok)
+	assert.InDelta(t, 5.56, spd, 0.01)
+	_, ok = pts[0].SpeedBetween(&pts[0])
+	assert.False(t, ok)
+	assert.Equal(t, pts[0].Timestamp, files[0].Tracks[0].Start())
+
+	_, err = LoadAll([]Source{FileSource(filepath.Join(dir, "missing.gpx"))}, 3)
+	assert.Error(t, err)
+}
+
+// testFIT is a FIT file with a definition and a single record message with a
+// timestamp, position and heart rate
+func testFIT() []byte {
+	messages := []byte{
+		0x40, 0, 0, 20, 0, 4, 253, 4, 0x86, 0, 4, 0x85, 1, 4, 0x85, 3, 1, 0x02,
+		0x00, 0, 0, 0, 0, 0, 0, 0, 0x20, 0, 0, 0, 0, 150,
+	}
+	binary.LittleEndian.PutUint32(messages[19:], 1000000000)
+	binary.LittleEndian.PutUint32(messages[23:], uint32(int32(45.0*(1<<31)/180)))
+	binary.LittleEndian.PutUint32(messages[27:], uint32(int32(45.0*(1<<31)/180)))
+	header := []byte{12, 0x20, 0, 0, 0, 0, 0, 0, '.', 'F', 'I', 'T'}
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(messages)))
+	data := append(header, messages...)
+	crc := make([]byte, 2)
+	binary.LittleEndian.PutUint16(crc, fit.CRC(data))
+	return append(data, crc...)
+}
+
+func TestReadFormats(t *testing.T) {
+	for _, name := range []string{"ride.fit", "ride.FIT", "stdin"} {
+		f, err := Read(name, bytes.NewReader(testFIT()))
+		assert.NoError(t, err, name)
+		pts := f.Tracks[0].Segments[0].Points
+		assert.Len(t, pts, 1)
+		assert.InDelta(t, 45, pts[0].Latitude, 1e-6)
+		assert.InDelta(t, 45, pts[0].Longitude, 1e-6)
+		assert.Equal(t, 150.0, pts[0].HeartRate.Value())
+		assert.Equal(t, 2021, pts[0].Timestamp.Year())
+	}
+
+	f, err := Read("stdin", strings.NewReader(fmt.Sprintf(testGPX, 1)))
+	assert.NoError(t, err)
+	assert.Equal(t, "ride 1", f.Tracks[0].Name)
+
+	// the extension wins over the contents
+	_, err = Read("ride.gpx", bytes.NewReader(testFIT()))
+	assert.Error(t, err)
+}
+
+func TestReadRoutesAndWaypoints(t *testing.T) {
+	doc := `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+  <wpt lat="45.0" lon="-93.0"><ele>250</ele><name>Coffee</name></wpt>
+  <rte>
+    <name>plan</name>
+    <rtept lat="45.0" lon="-93.0"/>
+    <rtept lat="45.001" lon="-93.0"/>
+  </rte>
+</gpx>`
+	f, err := Read("plan.gpx", strings.NewReader(doc))
+	assert.NoError(t, err)
+	assert.Empty(t, f.Tracks)
+	assert.Len(t, f.Routes, 1)
+	assert.Equal(t, "plan", f.Routes[0].Name)
+	assert.Len(t, f.Routes[0].Segments[0].Points, 2)
+	assert.Equal(t, 45.001, f.Routes[0].Segments[0].Points[1].Latitude)
+	assert.Equal(t, []Waypoint{{Latitude: 45, Longitude: -93, Elevation: *gpx.NewNullableFloat64(250), Name: "Coffee"}}, f.Waypoints)
+}